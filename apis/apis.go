@@ -1,6 +1,8 @@
 package apis
 
 import (
+	"fmt"
+
 	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
 	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
 	extsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
@@ -56,6 +58,7 @@ func NewControlPlaneCustomResource() *extsv1.CustomResourceDefinition {
 func NewAppCustomResource() *extsv1.CustomResourceDefinition {
 	apiVersions := []string{"v3", "v2", "v1"}
 	preserveUnknownFields := true
+	labelSelectorPath := ".status.labelSelector"
 	versions := make([]extsv1.CustomResourceDefinitionVersion, len(apiVersions))
 
 	for i, version := range apiVersions {
@@ -75,6 +78,11 @@ func NewAppCustomResource() *extsv1.CustomResourceDefinition {
 		}
 		versions[i].Subresources = &extsv1.CustomResourceSubresources{
 			Status: &extsv1.CustomResourceSubresourceStatus{},
+			Scale: &extsv1.CustomResourceSubresourceScale{
+				SpecReplicasPath:   ".spec.replicas",
+				StatusReplicasPath: ".status.replicas",
+				LabelSelectorPath:  &labelSelectorPath,
+			},
 		}
 	}
 
@@ -96,6 +104,72 @@ func NewAppCustomResource() *extsv1.CustomResourceDefinition {
 	}
 }
 
+func NewControlPlaneRestoreCustomResource() *extsv1.CustomResourceDefinition {
+	return newCustomResource("ControlPlaneRestore", "controlplanerestores", "controlplanerestore")
+}
+
+func NewAgentCustomResource() *extsv1.CustomResourceDefinition {
+	return newCustomResource("Agent", "agents", "agent")
+}
+
+func NewRegistryCustomResource() *extsv1.CustomResourceDefinition {
+	return newCustomResource("Registry", "registries", "registry")
+}
+
+func NewCatalogItemCustomResource() *extsv1.CustomResourceDefinition {
+	return newCustomResource("CatalogItem", "catalogitems", "catalogitem")
+}
+
+func NewEdgeResourceCustomResource() *extsv1.CustomResourceDefinition {
+	return newCustomResource("EdgeResource", "edgeresources", "edgeresource")
+}
+
+func NewApplicationTemplateCustomResource() *extsv1.CustomResourceDefinition {
+	crd := newCustomResource("ApplicationTemplate", "applicationtemplates", "applicationtemplate")
+	// Templates have no status
+	crd.Spec.Versions[0].Subresources = nil
+
+	return crd
+}
+
+// newCustomResource defines a v3 only custom resource with a status subresource.
+func newCustomResource(kind, plural, singular string) *extsv1.CustomResourceDefinition {
+	preserveUnknownFields := true
+
+	return &extsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("%s.iofog.org", plural),
+		},
+		Spec: extsv1.CustomResourceDefinitionSpec{
+			Group: "iofog.org",
+			Names: extsv1.CustomResourceDefinitionNames{
+				Kind:     kind,
+				ListKind: fmt.Sprintf("%sList", kind),
+				Plural:   plural,
+				Singular: singular,
+			},
+			Scope: extsv1.NamespaceScoped,
+			Versions: []extsv1.CustomResourceDefinitionVersion{
+				{
+					Name:    "v3",
+					Served:  true,
+					Storage: true,
+					Schema: &extsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &extsv1.JSONSchemaProps{
+							Properties:             map[string]extsv1.JSONSchemaProps{},
+							XPreserveUnknownFields: &preserveUnknownFields,
+							Type:                   "object",
+						},
+					},
+					Subresources: &extsv1.CustomResourceSubresources{
+						Status: &extsv1.CustomResourceSubresourceStatus{},
+					},
+				},
+			},
+		},
+	}
+}
+
 func sameVersionsSupported(left, right *extsv1.CustomResourceDefinition) bool {
 	for _, leftVersion := range left.Spec.Versions {
 		matched := false
@@ -125,6 +199,36 @@ func IsSupportedCustomResource(crd *extsv1.CustomResourceDefinition) bool {
 		return sameVersionsSupported(appCR, crd)
 	}
 
+	restoreCR := NewControlPlaneRestoreCustomResource()
+	if crd.Name == restoreCR.Name {
+		return sameVersionsSupported(restoreCR, crd)
+	}
+
+	agentCR := NewAgentCustomResource()
+	if crd.Name == agentCR.Name {
+		return sameVersionsSupported(agentCR, crd)
+	}
+
+	registryCR := NewRegistryCustomResource()
+	if crd.Name == registryCR.Name {
+		return sameVersionsSupported(registryCR, crd)
+	}
+
+	catalogItemCR := NewCatalogItemCustomResource()
+	if crd.Name == catalogItemCR.Name {
+		return sameVersionsSupported(catalogItemCR, crd)
+	}
+
+	edgeResourceCR := NewEdgeResourceCustomResource()
+	if crd.Name == edgeResourceCR.Name {
+		return sameVersionsSupported(edgeResourceCR, crd)
+	}
+
+	applicationTemplateCR := NewApplicationTemplateCustomResource()
+	if crd.Name == applicationTemplateCR.Name {
+		return sameVersionsSupported(applicationTemplateCR, crd)
+	}
+
 	return false
 }
 
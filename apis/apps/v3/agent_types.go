@@ -0,0 +1,115 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v3
+
+import (
+	cond "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConditionProvisioned reports whether the Agent exists in the ioFog Controller
+	ConditionProvisioned = "Provisioned"
+)
+
+// AgentSpec defines the desired state of an Agent registered in the ioFog Controller.
+type AgentSpec struct {
+	// ControlPlaneRef selects the ControlPlane the Agent is provisioned in.
+	// Defaults to the only ControlPlane in the namespace of the Agent.
+	ControlPlaneRef *ControlPlaneReference `json:"controlPlaneRef,omitempty"`
+	// Host is the address the Agent is reachable at
+	Host        string `json:"host,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Architecture is detected by the Agent when empty
+	// +kubebuilder:validation:Enum=x86;arm
+	Architecture string      `json:"architecture,omitempty"`
+	Tags         []string    `json:"tags,omitempty"`
+	Config       AgentConfig `json:"config,omitempty"`
+}
+
+type AgentConfig struct {
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	// +kubebuilder:validation:Enum=SEVERE;WARNING;INFO;CONFIG;FINE;FINER;FINEST
+	LogLevel string `json:"logLevel,omitempty"`
+	// DockerURL is the Docker daemon socket of the Agent, e.g. unix:///var/run/docker.sock
+	DockerURL string `json:"dockerUrl,omitempty"`
+	// DiskLimit in GiB
+	DiskLimit *int64 `json:"diskLimit,omitempty"`
+	// CPULimit in percent
+	CPULimit *int64 `json:"cpuLimit,omitempty"`
+	// MemoryLimit in MiB
+	MemoryLimit *int64 `json:"memoryLimit,omitempty"`
+}
+
+// AgentStatus defines the observed state of Agent.
+type AgentStatus struct {
+	// UUID of the Agent in the ioFog Controller
+	UUID string `json:"uuid,omitempty"`
+	// ProvisionKeySecret holds the key used to provision the Agent on its device
+	ProvisionKeySecret string `json:"provisionKeySecret,omitempty"`
+	// DaemonStatus as reported by the Agent, e.g. RUNNING or UNKNOWN
+	DaemonStatus string       `json:"daemonStatus,omitempty"`
+	LastSeen     *metav1.Time `json:"lastSeen,omitempty"`
+	Version      string       `json:"version,omitempty"`
+	// CPUUsage in percent
+	CPUUsage float64 `json:"cpuUsage,omitempty"`
+	// MemoryUsage in MiB
+	MemoryUsage          float64            `json:"memoryUsage,omitempty"`
+	RunningMicroservices int64              `json:"runningMicroservices,omitempty"`
+	ObservedGeneration   int64              `json:"observedGeneration,omitempty"`
+	Conditions           []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.daemonStatus`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.version`
+// +kubebuilder:printcolumn:name="Last Seen",type=date,JSONPath=`.status.lastSeen`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Agent is the Schema for the agents API.
+type Agent struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AgentSpec   `json:"spec,omitempty"`
+	Status AgentStatus `json:"status,omitempty"`
+}
+
+func (agent *Agent) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	cond.SetStatusCondition(&agent.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: agent.Generation,
+	})
+}
+
+// +kubebuilder:object:root=true
+
+// AgentList contains a list of Agent.
+type AgentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Agent `json:"items"`
+}
+
+func init() { //nolint:gochecknoinits
+	SchemeBuilder.Register(&Agent{}, &AgentList{})
+}
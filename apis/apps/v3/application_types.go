@@ -18,9 +18,36 @@ package v3
 
 import (
 	"github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/apps"
+	extsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	cond "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// ConditionDeployed reports whether the current spec was accepted by the ioFog Controller
+	ConditionDeployed = "Deployed"
+	// ConditionReady reports whether every microservice is running on its Agent
+	ConditionReady = "Ready"
+	// ConditionProgressing reports whether a spec change is being rolled out
+	ConditionProgressing = "Progressing"
+	// ConditionControlPlaneReady reports whether the ControlPlane the Application is deployed to is ready
+	ConditionControlPlaneReady = "ControlPlaneReady"
+	// ConditionTemplateValid reports whether the template of the Application expands with its variables
+	ConditionTemplateValid = "TemplateValid"
+	// ConditionTemplateOverridden reports whether the microservices and routes of the Application replace the ones of its template
+	ConditionTemplateOverridden = "TemplateOverridden"
+)
+
+const (
+	UpdateStrategyRecreate      = "Recreate"
+	UpdateStrategyRollingUpdate = "RollingUpdate"
+)
+
+const (
+	ArchitectureX86 = "x86"
+	ArchitectureARM = "arm"
+)
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -29,9 +56,69 @@ type ApplicationSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 	// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
-	Microservices []apps.Microservice `json:"microservices"`
-	Routes        []apps.Route        `json:"routes"`
-	Replicas      int32               `json:"replicas"`
+	Microservices []apps.Microservice `json:"microservices,omitempty"`
+	Routes        []apps.Route        `json:"routes,omitempty"`
+	// Replicas is the number of copies of the microservices deployed, scaled through the scale subresource.
+	// More than one replica requires a placement for every microservice, so that replicas are spread across Agents
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+	// UpdateStrategy controls how spec changes reach the Agents
+	UpdateStrategy ApplicationUpdateStrategy `json:"updateStrategy,omitempty"`
+	// ControlPlaneRef selects the ControlPlane the Application is deployed to.
+	// Defaults to the only ControlPlane in the namespace of the Application.
+	ControlPlaneRef *ControlPlaneReference `json:"controlPlaneRef,omitempty"`
+	// Placement chooses the Agents of microservices, overriding the Agent named in their spec
+	Placement []MicroservicePlacement `json:"placement,omitempty"`
+	// TemplateRef selects an ApplicationTemplate providing the microservices and routes of the Application
+	TemplateRef *ApplicationTemplateReference `json:"templateRef,omitempty"`
+	// Variables are the values of the variables of the template
+	Variables []ApplicationVariable `json:"variables,omitempty"`
+}
+
+type ApplicationTemplateReference struct {
+	Name string `json:"name"`
+	// Namespace defaults to the namespace of the Application.
+	// Templates of other namespaces must list the namespace of the Application in spec.allowedNamespaces.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type ApplicationVariable struct {
+	Name  string      `json:"name"`
+	Value extsv1.JSON `json:"value"`
+}
+
+// MicroservicePlacement constraints are resolved against the Agents known to the ioFog Controller.
+// An Agent tag key=value is matched as the label key with the value value, any other tag as a label with an empty value.
+type MicroservicePlacement struct {
+	// Microservice is the name of a microservice of the spec
+	Microservice string `json:"microservice"`
+	// Agent pins the microservice to an Agent by name
+	Agent string `json:"agent,omitempty"`
+	// AgentSelector matches the tags of the Agents
+	AgentSelector *metav1.LabelSelector `json:"agentSelector,omitempty"`
+	// +kubebuilder:validation:Enum=x86;arm
+	Architecture string `json:"architecture,omitempty"`
+	// FallbackAgents are tried in order when no Agent satisfies the constraints above
+	FallbackAgents []string `json:"fallbackAgents,omitempty"`
+}
+
+type ControlPlaneReference struct {
+	Name string `json:"name"`
+	// Namespace defaults to the namespace of the resource.
+	// ControlPlanes of other namespaces must list the namespace of the resource in spec.allowedNamespaces.
+	// The resource is then named <namespace>-<name> on the ioFog Controller.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type ApplicationUpdateStrategy struct {
+	// Recreate deletes and redeploys the whole application.
+	// RollingUpdate (default) updates the changed microservices one Agent at a time.
+	// +kubebuilder:validation:Enum=Recreate;RollingUpdate
+	Type string `json:"type,omitempty"`
+	// ProgressDeadlineSeconds is how long an Agent may take to run its updated microservices before the rolling update
+	// is reported as not progressing, with the ProgressDeadlineExceeded reason. Defaults to 600
+	// +kubebuilder:validation:Minimum=1
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
 }
 
 // ApplicationStatus defines the observed state of Application.
@@ -39,13 +126,60 @@ type ApplicationStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 	// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
-	Replicas      int32    `json:"replicas"`
-	LabelSelector string   `json:"labelSelector"`
-	PodNames      []string `json:"podNames"`
+	Replicas int32 `json:"replicas"`
+	// LabelSelector is app=<name>, for the scale subresource. Microservices are not pods, so HorizontalPodAutoscalers of
+	// Applications scale on metrics labelled with it rather than on the resources of pods
+	LabelSelector string `json:"labelSelector"`
+	// ObservedGeneration is the generation of the spec last deployed to the ioFog Controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Microservices reports the state of each microservice on its Agent
+	Microservices []MicroserviceStatus `json:"microservices,omitempty"`
+	Conditions    []metav1.Condition   `json:"conditions,omitempty"`
+	// Rollout tracks the progress of the spec change being applied
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+	// Placements records the Agent chosen for each microservice
+	Placements []PlacementStatus `json:"placements,omitempty"`
+	// DeployedHashes holds a hash of each microservice spec last deployed, so that only changed microservices are rolled out
+	DeployedHashes map[string]string `json:"deployedHashes,omitempty"`
+	// TemplateHash identifies the expanded template last deployed, so that template changes are rolled out
+	TemplateHash string `json:"templateHash,omitempty"`
+}
+
+type PlacementStatus struct {
+	Microservice string `json:"microservice"`
+	Agent        string `json:"agent"`
+	// Fallback is set when the Agent was taken from the fallback Agents
+	Fallback bool `json:"fallback,omitempty"`
+}
+
+type RolloutStatus struct {
+	// Generation of the spec being rolled out
+	Generation int64  `json:"generation"`
+	Strategy   string `json:"strategy"`
+	// CurrentAgent is the Agent whose microservices are being updated
+	CurrentAgent          string       `json:"currentAgent,omitempty"`
+	CurrentAgentStartTime *metav1.Time `json:"currentAgentStartTime,omitempty"`
+	UpdatedAgents         []string     `json:"updatedAgents,omitempty"`
+	PendingAgents         []string     `json:"pendingAgents,omitempty"`
+}
+
+type MicroserviceStatus struct {
+	Name  string `json:"name"`
+	UUID  string `json:"uuid,omitempty"`
+	Agent string `json:"agent,omitempty"`
+	Image string `json:"image,omitempty"`
+	// Status as reported by the Agent, e.g. PULLING or RUNNING
+	Status       string       `json:"status,omitempty"`
+	StartTime    *metav1.Time `json:"startTime,omitempty"`
+	ErrorMessage string       `json:"errorMessage,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.labelSelector
+// +kubebuilder:printcolumn:name="Deployed",type=string,JSONPath=`.status.conditions[?(@.type=="Deployed")].status`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Application is the Schema for the applications API.
 type Application struct {
@@ -56,6 +190,21 @@ type Application struct {
 	Status ApplicationStatus `json:"status,omitempty"`
 }
 
+// SetCondition records the state of conditionType, only moving its transition time when the status changes.
+func (app *Application) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	cond.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: app.Generation,
+	})
+}
+
+func (app *Application) IsReady() bool {
+	return cond.IsStatusConditionTrue(app.Status.Conditions, ConditionReady)
+}
+
 // +kubebuilder:object:root=true
 
 // ApplicationList contains a list of Application.
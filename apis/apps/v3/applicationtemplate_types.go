@@ -0,0 +1,93 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v3
+
+import (
+	extsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	VariableTypeString  = "string"
+	VariableTypeInteger = "integer"
+	VariableTypeNumber  = "number"
+	VariableTypeBoolean = "boolean"
+)
+
+type TemplateVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// +kubebuilder:validation:Enum=string;integer;number;boolean
+	// +kubebuilder:default=string
+	Type string `json:"type,omitempty"`
+	// Default makes the variable optional
+	Default *extsv1.JSON `json:"default,omitempty"`
+}
+
+// ApplicationTemplateSpec defines an application deployed by Applications referring to the template.
+type ApplicationTemplateSpec struct {
+	Description string             `json:"description,omitempty"`
+	Variables   []TemplateVariable `json:"variables,omitempty"`
+	// Application is an ApplicationSpec whose values may refer to variables as {{ name }}.
+	// A value made of a single reference takes the type of the variable, other references are replaced by its text.
+	// Its microservices, routes, placement and update strategy are used unless the Application sets its own,
+	// which the TemplateOverridden condition of the Application reports for microservices and routes.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Application runtime.RawExtension `json:"application"`
+	// AllowedNamespaces may reference this template through spec.templateRef besides its own namespace, * allows all of them.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ApplicationTemplate is the Schema for the applicationtemplates API.
+type ApplicationTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ApplicationTemplateSpec `json:"spec,omitempty"`
+}
+
+// AllowsNamespace reports whether Applications of namespace may expand the template.
+func (template *ApplicationTemplate) AllowsNamespace(namespace string) bool {
+	if namespace == template.Namespace {
+		return true
+	}
+
+	for _, allowed := range template.Spec.AllowedNamespaces {
+		if allowed == "*" || allowed == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// +kubebuilder:object:root=true
+
+// ApplicationTemplateList contains a list of ApplicationTemplate.
+type ApplicationTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ApplicationTemplate `json:"items"`
+}
+
+func init() { //nolint:gochecknoinits
+	SchemeBuilder.Register(&ApplicationTemplate{}, &ApplicationTemplateList{})
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v3
+
+import (
+	cond "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CatalogImages are the images of a catalog item, one per Agent architecture.
+type CatalogImages struct {
+	X86 string `json:"x86,omitempty"`
+	ARM string `json:"arm,omitempty"`
+}
+
+// CatalogItemSpec defines a microservice of the catalog of the ioFog Controller.
+// The item is named after the CatalogItem.
+type CatalogItemSpec struct {
+	// ControlPlaneRef selects the ControlPlane the item is added to.
+	// Defaults to the only ControlPlane in the namespace of the CatalogItem.
+	ControlPlaneRef *ControlPlaneReference `json:"controlPlaneRef,omitempty"`
+	Description     string                 `json:"description,omitempty"`
+	Category        string                 `json:"category,omitempty"`
+	Images          CatalogImages          `json:"images"`
+	// RegistryRef names a Registry in the namespace of the CatalogItem the images are pulled from.
+	// Defaults to Docker Hub.
+	RegistryRef string `json:"registryRef,omitempty"`
+}
+
+// CatalogItemStatus defines the observed state of CatalogItem.
+type CatalogItemStatus struct {
+	// ID of the item in the catalog of the ioFog Controller
+	ID int64 `json:"id,omitempty"`
+	// RegistryID of the registry the images are pulled from in the ioFog Controller
+	RegistryID         int64              `json:"registryId,omitempty"`
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="ID",type=integer,JSONPath=`.status.id`
+// +kubebuilder:printcolumn:name="Category",type=string,JSONPath=`.spec.category`
+// +kubebuilder:printcolumn:name="Synced",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CatalogItem is the Schema for the catalogitems API.
+type CatalogItem struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CatalogItemSpec   `json:"spec,omitempty"`
+	Status CatalogItemStatus `json:"status,omitempty"`
+}
+
+func (item *CatalogItem) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	cond.SetStatusCondition(&item.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: item.Generation,
+	})
+}
+
+// +kubebuilder:object:root=true
+
+// CatalogItemList contains a list of CatalogItem.
+type CatalogItemList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CatalogItem `json:"items"`
+}
+
+func init() { //nolint:gochecknoinits
+	SchemeBuilder.Register(&CatalogItem{}, &CatalogItemList{})
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v3
+
+import (
+	cond "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	EdgeResourceProtocolHTTPS = "https"
+)
+
+type EdgeResourceDisplay struct {
+	Name  string `json:"name,omitempty"`
+	Icon  string `json:"icon,omitempty"`
+	Color string `json:"color,omitempty"`
+}
+
+// EdgeResourceHTTPEndpoint is an endpoint microservices call to interact with the edge resource.
+type EdgeResourceHTTPEndpoint struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// +kubebuilder:validation:Enum=GET;POST;PUT;PATCH;DELETE
+	Method                 string `json:"method"`
+	URL                    string `json:"url"`
+	RequestType            string `json:"requestType,omitempty"`
+	ResponseType           string `json:"responseType,omitempty"`
+	RequestPayloadExample  string `json:"requestPayloadExample,omitempty"`
+	ResponsePayloadExample string `json:"responsePayloadExample,omitempty"`
+}
+
+type EdgeResourceInterface struct {
+	Endpoints []EdgeResourceHTTPEndpoint `json:"endpoints,omitempty"`
+}
+
+// EdgeResourceSpec defines a device or service Agents expose to microservices.
+// The edge resource is named after the EdgeResource.
+type EdgeResourceSpec struct {
+	// ControlPlaneRef selects the ControlPlane the edge resource is defined in.
+	// Defaults to the only ControlPlane in the namespace of the EdgeResource.
+	ControlPlaneRef *ControlPlaneReference `json:"controlPlaneRef,omitempty"`
+	// Version of the edge resource. Changing it replaces the previous version in the ioFog Controller.
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+	// +kubebuilder:validation:Enum=https
+	// +kubebuilder:default=https
+	InterfaceProtocol string                 `json:"interfaceProtocol,omitempty"`
+	Display           *EdgeResourceDisplay   `json:"display,omitempty"`
+	Interface         *EdgeResourceInterface `json:"interface,omitempty"`
+	OrchestrationTags []string               `json:"orchestrationTags,omitempty"`
+	// Custom holds arbitrary metadata of the edge resource
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Custom *runtime.RawExtension `json:"custom,omitempty"`
+}
+
+// EdgeResourceStatus defines the observed state of EdgeResource.
+type EdgeResourceStatus struct {
+	// Name and Version identify the edge resource in the ioFog Controller
+	Name               string             `json:"name,omitempty"`
+	Version            string             `json:"version,omitempty"`
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.version`
+// +kubebuilder:printcolumn:name="Synced",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EdgeResource is the Schema for the edgeresources API.
+type EdgeResource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EdgeResourceSpec   `json:"spec,omitempty"`
+	Status EdgeResourceStatus `json:"status,omitempty"`
+}
+
+func (resource *EdgeResource) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	cond.SetStatusCondition(&resource.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: resource.Generation,
+	})
+}
+
+// +kubebuilder:object:root=true
+
+// EdgeResourceList contains a list of EdgeResource.
+type EdgeResourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EdgeResource `json:"items"`
+}
+
+func init() { //nolint:gochecknoinits
+	SchemeBuilder.Register(&EdgeResource{}, &EdgeResourceList{})
+}
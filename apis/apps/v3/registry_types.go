@@ -0,0 +1,93 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v3
+
+import (
+	cond "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConditionSynced reports whether the resource matches its counterpart in the ioFog Controller
+	ConditionSynced = "Synced"
+)
+
+// RegistrySpec defines an image registry the Agents of the ioFog Controller pull microservice images from.
+type RegistrySpec struct {
+	// ControlPlaneRef selects the ControlPlane the Registry is configured in.
+	// Defaults to the only ControlPlane in the namespace of the Registry.
+	ControlPlaneRef *ControlPlaneReference `json:"controlPlaneRef,omitempty"`
+	// URL of the registry, e.g. registry.hub.docker.com.
+	// Defaults to the only registry of the Secret.
+	URL string `json:"url,omitempty"`
+	// SecretName is a kubernetes.io/dockerconfigjson Secret holding the credentials of the registry
+	SecretName string `json:"secretName,omitempty"`
+	// Public registries are pulled from without credentials
+	Public bool `json:"public,omitempty"`
+}
+
+// RegistryStatus defines the observed state of Registry.
+type RegistryStatus struct {
+	// ID of the registry the Registry created in the ioFog Controller.
+	// Registries with the same URL that it did not create are reported with the Conflict reason instead of being adopted.
+	ID  int64  `json:"id,omitempty"`
+	URL string `json:"url,omitempty"`
+	// CredentialsHash is an HMAC of the credentials last synchronized, keyed with the password of the ioFog Controller user,
+	// so that rotating the Secret updates the registry
+	CredentialsHash    string             `json:"credentialsHash,omitempty"`
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`
+// +kubebuilder:printcolumn:name="ID",type=integer,JSONPath=`.status.id`
+// +kubebuilder:printcolumn:name="Synced",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Registry is the Schema for the registries API.
+type Registry struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RegistrySpec   `json:"spec,omitempty"`
+	Status RegistryStatus `json:"status,omitempty"`
+}
+
+func (registry *Registry) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	cond.SetStatusCondition(&registry.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: registry.Generation,
+	})
+}
+
+// +kubebuilder:object:root=true
+
+// RegistryList contains a list of Registry.
+type RegistryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Registry `json:"items"`
+}
+
+func init() { //nolint:gochecknoinits
+	SchemeBuilder.Register(&Registry{}, &RegistryList{})
+}
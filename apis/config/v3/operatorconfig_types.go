@@ -0,0 +1,95 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+)
+
+const (
+	LogEncoderJSON    = "json"
+	LogEncoderConsole = "console"
+)
+
+const (
+	ControllerAccessInCluster = "InCluster"
+	ControllerAccessExternal  = "External"
+)
+
+// LoggingConfig configures the logs of the operator.
+type LoggingConfig struct {
+	// Development logs are human readable, include stack traces from warnings and default to the debug level
+	Development bool `json:"development,omitempty"`
+	// Encoder is json or console. Defaults to json, or console in development.
+	Encoder string `json:"encoder,omitempty"`
+	// Level is debug, info or error, or an integer above zero for more verbose logs. Defaults to info.
+	Level string `json:"level,omitempty"`
+	// StacktraceLevel is the level from which stack traces are logged, info or error. Defaults to error.
+	StacktraceLevel string `json:"stacktraceLevel,omitempty"`
+}
+
+// ControllerAccessConfig configures how the operator reaches the ioFog Controllers of ControlPlanes.
+type ControllerAccessConfig struct {
+	// Mode is InCluster to reach Controllers through the DNS names of their Services, or External to reach them
+	// through the addresses of their LoadBalancers. Defaults to InCluster when the operator runs in a pod, External otherwise.
+	Mode string `json:"mode,omitempty"`
+	// Addresses of forwarded Controller API ports by namespace of their ControlPlane, e.g. iofog: localhost:51121
+	// while kubectl port-forward -n iofog svc/controller 51121 runs. They take precedence over Mode.
+	Addresses map[string]string `json:"addresses,omitempty"`
+}
+
+// ImagesConfig overrides the third party images of the Jobs which back up, restore and migrate the databases of
+// ControlPlanes, e.g. to pull them from a mirror.
+type ImagesConfig struct {
+	// Sqlite is the image of the sqlite3 client
+	Sqlite string `json:"sqlite,omitempty"`
+	// Postgres is the repository of the postgres clients, tagged <major version>-alpine after spec.database.version
+	Postgres string `json:"postgres,omitempty"`
+	// MySQL is the image of the mysql clients
+	MySQL string `json:"mysql,omitempty"`
+	// S3Transfer is the image of the MinIO client moving snapshots to and from S3 targets
+	S3Transfer string `json:"s3Transfer,omitempty"`
+	// PVCTransfer is the image moving snapshots to and from PersistentVolumeClaim targets
+	PVCTransfer string `json:"pvcTransfer,omitempty"`
+	// Migration is the image of pgloader, which copies sqlite databases to postgres
+	Migration string `json:"migration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// OperatorConfig is the configuration file of the operator, loaded with --config.
+// Manager settings, e.g. health probes, leader election and the concurrency of each controller, follow the
+// ControllerManagerConfiguration of controller-runtime.
+type OperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	cfg.ControllerManagerConfigurationSpec `json:",inline"`
+
+	Logging LoggingConfig `json:"logging,omitempty"`
+
+	// ClusterDomain is the DNS domain of the cluster. Defaults to the one found in /etc/resolv.conf, or cluster.local.
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+
+	ControllerAccess ControllerAccessConfig `json:"controllerAccess,omitempty"`
+
+	Images ImagesConfig `json:"images,omitempty"`
+}
+
+func init() { //nolint:gochecknoinits
+	SchemeBuilder.Register(&OperatorConfig{})
+}
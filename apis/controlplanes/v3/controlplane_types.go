@@ -18,17 +18,54 @@ package v3
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
 	cond "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const (
 	conditionReady     = "ready"
 	conditionDeploying = "deploying"
+
+	// RestoreInProgressAnnotation is set on a ControlPlane while a ControlPlaneRestore owns its Controller Deployment.
+	RestoreInProgressAnnotation = "iofog.org/restore-in-progress"
+	// RestoreFromAnnotation requests a restore of the named backup, it is replaced by a ControlPlaneRestore.
+	RestoreFromAnnotation = "iofog.org/restore-from"
+)
+
+// Steps of a migration from sqlite to an external database.
+const (
+	MigrationPhaseStopping       = "stopping_controller"
+	MigrationPhaseCreatingSchema = "creating_schema"
+	MigrationPhaseCopying        = "copying"
+	MigrationPhaseVerifying      = "verifying"
+	MigrationPhaseSwitchingOver  = "switching_over"
+	MigrationPhaseCompleted      = "completed"
+	MigrationPhaseFailed         = "failed"
+)
+
+// Steps of the deployment of a ControlPlane component.
+const (
+	ComponentPhasePending     = "pending"
+	ComponentPhaseReconciling = "reconciling"
+	ComponentPhaseWaiting     = "waiting"
+	ComponentPhaseReady       = "ready"
+	ComponentPhaseFailed      = "failed"
+)
+
+// Conditions reporting the rollout of the Deployment of each component, alongside the ready and deploying states.
+const (
+	ConditionRouterAvailable      = "RouterAvailable"
+	ConditionControllerAvailable  = "ControllerAvailable"
+	ConditionPortManagerAvailable = "PortManagerAvailable"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -42,6 +79,8 @@ type ControlPlaneSpec struct {
 	// User contains credentials for ioFog Controller
 	User User `json:"user"`
 	// Database is only used when ioFog Controller is configured to connect to an external DB.
+	// Setting it on a ControlPlane running on sqlite migrates the data of the Controller, which is only supported
+	// towards postgres: with mysql the migration fails and the Controller keeps running on sqlite.
 	Database Database `json:"database,omitempty"`
 	// Ingresses allow Router and Port Manager to configure endpoint addresses correctly
 	Ingresses Ingresses `json:"ingresses,omitempty"`
@@ -53,21 +92,100 @@ type ControlPlaneSpec struct {
 	Images Images `json:"images,omitempty"`
 	// Controller contains runtime configuration for ioFog Controller
 	Controller Controller `json:"controller,omitempty"`
+	// Backup schedules snapshots of the ioFog Controller database
+	Backup Backup `json:"backup,omitempty"`
+	// Autoscaling replaces Replicas with a HorizontalPodAutoscaler
+	Autoscaling Autoscaling `json:"autoscaling,omitempty"`
+	// PortManager contains runtime configuration for the Port Manager, which exposes microservice ports through the proxy.
+	// The Port Manager always exposes the proxy through a LoadBalancer on the ports microservices ask for,
+	// so only its resources, and its replicas through spec.replicas, are configurable
+	PortManager PortManager `json:"portManager,omitempty"`
+	// AllowedNamespaces may reference this ControlPlane through spec.controlPlaneRef besides its own namespace, * allows all of them.
+	// Resources of these namespaces are deployed with the credentials of its Controller.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+}
+
+type PortManager struct {
+	// Resources of the Port Manager container
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+type Autoscaling struct {
+	// Controller can only be autoscaled when an external DB is configured
+	Controller *HorizontalAutoscaling `json:"controller,omitempty"`
+}
+
+type HorizontalAutoscaling struct {
+	// MinReplicas defaults to 1
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+	MaxReplicas int32 `json:"maxReplicas"`
+	// TargetCPUUtilizationPercentage defaults to 80 and is ignored when Metrics are specified
+	TargetCPUUtilizationPercentage int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// Metrics are passed to the HorizontalPodAutoscaler, e.g. to scale on custom or external metrics
+	Metrics []autoscalingv2.MetricSpec `json:"metrics,omitempty"`
+	// MaxUnavailable pods of the PodDisruptionBudget, defaults to 1
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+type Backup struct {
+	// Schedule in Cron format, backups are disabled when empty
+	Schedule string `json:"schedule,omitempty"`
+	// Target receives the snapshots
+	Target BackupTarget `json:"target,omitempty"`
+	// DumpImage overrides the image used to read the database, the sqlite, postgres or mysql image of the OperatorConfig
+	DumpImage string `json:"dumpImage,omitempty"`
+	// TransferImage overrides the image used to move snapshots to and from the target
+	TransferImage              string `json:"transferImage,omitempty"`
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	FailedJobsHistoryLimit     *int32 `json:"failedJobsHistoryLimit,omitempty"`
+}
+
+// BackupTarget must specify exactly one of PersistentVolumeClaim or S3.
+type BackupTarget struct {
+	// PersistentVolumeClaim is the name of an existing claim in the ControlPlane namespace
+	PersistentVolumeClaim string   `json:"persistentVolumeClaim,omitempty"`
+	S3                    S3Target `json:"s3,omitempty"`
+}
+
+type S3Target struct {
+	// Endpoint of the S3 compatible API, e.g. https://s3.amazonaws.com or http://minio:9000
+	Endpoint string `json:"endpoint,omitempty"`
+	Bucket   string `json:"bucket,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+	// CredentialsSecret contains the access-key-id and secret-access-key keys
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	// Insecure skips TLS verification of the endpoint
+	Insecure bool `json:"insecure,omitempty"`
 }
 
 type Replicas struct {
 	Controller int32 `json:"controller,omitempty"`
+	// PortManager defaults to 1
+	PortManager int32 `json:"portManager,omitempty"`
 }
 
+// ServiceTypeHostNetwork binds the Router to the ports of the node it runs on, for clusters without LoadBalancers.
+const ServiceTypeHostNetwork = "HostNetwork"
+
 type Services struct {
 	Controller Service `json:"controller,omitempty"`
-	Router     Service `json:"router,omitempty"`
-	Proxy      Service `json:"proxy,omitempty"`
+	// Router also accepts NodePort and HostNetwork, in which case its address defaults to the address of a node
+	Router Service `json:"router,omitempty"`
+	// Proxy describes the Service the Port Manager creates for the proxy, which is always a LoadBalancer.
+	// NodePort and HostNetwork are rejected, set the addresses of the proxy in spec.ingresses instead.
+	// IPFamilies and IPFamilyPolicy are rejected as well, the proxy uses the default IP family of the cluster
+	Proxy Service `json:"proxy,omitempty"`
 }
 
 type Service struct {
 	Type    string `json:"type,omitempty"`
 	Address string `json:"address,omitempty"`
+	// IPFamilies of the Service, e.g. [IPv6] on IPv6 only clusters or [IPv4, IPv6] on dual-stack clusters.
+	// The first family is the primary one, and selects which address is registered with the ioFog Controller.
+	// Only applies to the Controller and Router Services
+	IPFamilies []corev1.IPFamily `json:"ipFamilies,omitempty"`
+	// IPFamilyPolicy is SingleStack, PreferDualStack or RequireDualStack. Only applies to the Controller and Router Services
+	IPFamilyPolicy *corev1.IPFamilyPolicy `json:"ipFamilyPolicy,omitempty"`
 }
 
 type Images struct {
@@ -80,12 +198,17 @@ type Images struct {
 }
 
 type Database struct {
+	// Provider is postgres or mysql. Only postgres databases can be migrated to from sqlite
 	Provider     string `json:"provider"`
 	Host         string `json:"host"`
 	Port         int    `json:"port"`
 	User         string `json:"user"`
 	Password     string `json:"password"`
 	DatabaseName string `json:"databaseName"`
+	// Version is the major version of a postgres server, e.g. 16. The backup, restore and migration Jobs use the
+	// postgres clients of the same version. Defaults to 15
+	// +kubebuilder:validation:Pattern=`^[0-9]+$`
+	Version string `json:"version,omitempty"`
 }
 
 type User struct {
@@ -110,6 +233,48 @@ type Ingresses struct {
 	Router    RouterIngress `json:"router,omitempty"`
 	HTTPProxy Ingress       `json:"httpProxy,omitempty"`
 	TCPProxy  Ingress       `json:"tcpProxy,omitempty"`
+	// Controller generates routes to the ioFog Controller API and ECN Viewer
+	Controller ControllerIngress `json:"controller,omitempty"`
+}
+
+const (
+	RouteKindIngress  = "Ingress"
+	RouteKindGateway  = "Gateway"
+	RouteProtocolHTTP = "HTTP"
+	RouteProtocolTCP  = "TCP"
+)
+
+type ControllerIngress struct {
+	// Kind of the generated resources, Ingress or Gateway for Gateway API routes. Nothing is generated when empty
+	Kind string `json:"kind,omitempty"`
+	// IngressClassName of the generated Ingress
+	IngressClassName string `json:"ingressClassName,omitempty"`
+	// Gateway the generated HTTPRoutes and TCPRoutes attach to
+	Gateway     GatewayReference  `json:"gateway,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// API routes to the Controller REST API on port 51121
+	API Route `json:"api,omitempty"`
+	// Viewer routes to the ECN Viewer on port 80
+	Viewer Route `json:"viewer,omitempty"`
+}
+
+type GatewayReference struct {
+	Name string `json:"name,omitempty"`
+	// Namespace defaults to the namespace of the ControlPlane
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type Route struct {
+	Host string `json:"host,omitempty"`
+	// Path prefix, defaults to /api for the API and / for the Viewer. Ignored by TCPRoutes
+	Path string `json:"path,omitempty"`
+	// TLSSecretName is referenced by the Ingress, and makes the ECN Viewer URL use https.
+	// It is rejected for Gateway routes, as Gateways terminate TLS with the certificates of their listeners
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+	// SectionName selects a listener of the Gateway
+	SectionName string `json:"sectionName,omitempty"`
+	// Protocol of the Gateway route, HTTP or TCP. Defaults to HTTP
+	Protocol string `json:"protocol,omitempty"`
 }
 
 type Controller struct {
@@ -121,6 +286,54 @@ type Controller struct {
 	PortAllocatorHost string `json:"portAllocatorHost,omitempty"`
 	ProxyBrokerURL    string `json:"proxyBrokerUrl,omitempty"`
 	ProxyBrokerToken  string `json:"proxyBrokerToken,omitempty"`
+	// Storage configures the PersistentVolumeClaim holding the sqlite database when no external DB is configured
+	Storage Storage `json:"storage,omitempty"`
+	// Resources of the ioFog Controller container, CPU requests are required for CPU based autoscaling
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// TLS serves the ioFog Controller API over HTTPS
+	TLS *ControllerTLS `json:"tls,omitempty"`
+}
+
+// Sources of the certificate of the ioFog Controller.
+const (
+	ControllerTLSModeSelfSigned  = "SelfSigned"
+	ControllerTLSModeCertManager = "CertManager"
+	ControllerTLSModeSecret      = "Secret"
+)
+
+// DefaultControllerTLSSecretName holds the certificate of the ioFog Controller unless another secret is configured.
+const DefaultControllerTLSSecretName = "controller-tls"
+
+type ControllerTLS struct {
+	// Mode is SelfSigned, CertManager to request a certificate from cert-manager, or Secret to use an existing secret
+	Mode string `json:"mode"`
+	// SecretName holds the tls.crt, tls.key and ca.crt keys. Required by the Secret mode, defaults to controller-tls
+	SecretName string `json:"secretName,omitempty"`
+	// IssuerRef of the cert-manager Certificate, required by the CertManager mode
+	IssuerRef *CertManagerIssuerReference `json:"issuerRef,omitempty"`
+	// Hosts are added to the certificate besides the names of the Controller Service, e.g. the address of its LoadBalancer
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+type CertManagerIssuerReference struct {
+	Name string `json:"name"`
+	// Kind is Issuer or ClusterIssuer, defaults to Issuer
+	Kind string `json:"kind,omitempty"`
+	// Group defaults to cert-manager.io
+	Group string `json:"group,omitempty"`
+}
+
+type Storage struct {
+	// Size of the claim, e.g. 1Gi. Increasing it expands an existing claim if its StorageClass allows expansion
+	Size             string            `json:"size,omitempty"`
+	StorageClassName string            `json:"storageClassName,omitempty"`
+	AccessModes      []string          `json:"accessModes,omitempty"`
+	Annotations      map[string]string `json:"annotations,omitempty"`
+}
+
+type StorageStatus struct {
+	Phase    string `json:"phase,omitempty"`
+	Capacity string `json:"capacity,omitempty"`
 }
 
 // ControlPlaneStatus defines the observed state of ControlPlane.
@@ -128,6 +341,50 @@ type ControlPlaneStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Conditions []metav1.Condition `json:"conditions"`
+	// Storage reports the PersistentVolumeClaim of the sqlite database
+	Storage StorageStatus `json:"storage,omitempty"`
+	// DatabaseMigration reports the progress of moving from sqlite to an external database
+	DatabaseMigration *DatabaseMigrationStatus `json:"databaseMigration,omitempty"`
+	// Components reports the deployment step of the Router, Controller and Port Manager
+	Components []ComponentStatus `json:"components,omitempty"`
+	// Routes lists the Ingress and Gateway API routes generated for the Controller, which are deleted once no longer configured
+	Routes []GeneratedRoute `json:"routes,omitempty"`
+}
+
+type GeneratedRoute struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+}
+
+type ComponentStatus struct {
+	Name  string `json:"name"`
+	Phase string `json:"phase"`
+	// Message explains why the component is waiting or failed
+	Message string `json:"message,omitempty"`
+	// DependsOn lists the components which must be ready before this one is deployed
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// Rollout reports the progress of the Deployment of the component
+	Rollout *DeploymentRolloutStatus `json:"rollout,omitempty"`
+}
+
+type DeploymentRolloutStatus struct {
+	Replicas          int32 `json:"replicas"`
+	UpdatedReplicas   int32 `json:"updatedReplicas"`
+	ReadyReplicas     int32 `json:"readyReplicas"`
+	AvailableReplicas int32 `json:"availableReplicas"`
+	// Reason is RolloutComplete, RollingOut, ProgressDeadlineExceeded or ReplicaFailure
+	Reason string `json:"reason"`
+}
+
+type DatabaseMigrationStatus struct {
+	Phase string `json:"phase,omitempty"`
+	// Message explains a failure, or lists the verified row counts
+	Message string `json:"message,omitempty"`
+	// Target is the endpoint of the external database being migrated to
+	Target         string       `json:"target,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -141,11 +398,19 @@ type ControlPlane struct {
 	Status ControlPlaneStatus `json:"status,omitempty"`
 }
 
+// isStateCondition reports whether conditionType is one of the states of the ControlPlane, only one of which is true at a time.
+func isStateCondition(conditionType string) bool {
+	return conditionType == conditionReady || conditionType == conditionDeploying
+}
+
 func (cp *ControlPlane) setCondition(conditionType string, log *logr.Logger) {
 	now := metav1.NewTime(time.Now())
 	// Clear all
 	for idx := range cp.Status.Conditions {
 		condition := &cp.Status.Conditions[idx]
+		if !isStateCondition(condition.Type) {
+			continue
+		}
 		// Migration: all lower case, no spaces, no -
 		condition.Reason = strings.ToLower(condition.Reason)
 		condition.Reason = strings.Replace(condition.Reason, " ", "_", -1)
@@ -180,11 +445,22 @@ func (cp *ControlPlane) SetConditionReady(log *logr.Logger) {
 	cp.setCondition(conditionReady, log)
 }
 
+// SetCondition records a condition which is not a state of the ControlPlane, such as the availability of a component.
+func (cp *ControlPlane) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	cond.SetStatusCondition(&cp.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: cp.Generation,
+	})
+}
+
 func (cp *ControlPlane) GetCondition() string {
 	state := conditionDeploying
 
 	for _, condition := range cp.Status.Conditions {
-		if condition.Status == metav1.ConditionTrue {
+		if isStateCondition(condition.Type) && condition.Status == metav1.ConditionTrue {
 			state = condition.Type
 
 			break
@@ -198,10 +474,74 @@ func (cp *ControlPlane) IsReady() bool {
 	return cp.GetCondition() == conditionReady
 }
 
+// AllowsNamespace reports whether resources of namespace may be deployed to the ControlPlane.
+func (cp *ControlPlane) AllowsNamespace(namespace string) bool {
+	if namespace == cp.Namespace {
+		return true
+	}
+
+	for _, allowed := range cp.Spec.AllowedNamespaces {
+		if allowed == "*" || allowed == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (cp *ControlPlane) IsDeploying() bool {
 	return cp.GetCondition() == conditionDeploying
 }
 
+func (cp *ControlPlane) IsRestoring() bool {
+	_, found := cp.Annotations[RestoreInProgressAnnotation]
+
+	return found
+}
+
+// IsMigratingTo reports whether the last database migration targeted db.
+func (cp *ControlPlane) IsMigratingTo(db *Database) bool {
+	migration := cp.Status.DatabaseMigration
+
+	return migration != nil && migration.Target == db.Endpoint()
+}
+
+// Endpoint identifies an external database without its credentials.
+func (db *Database) Endpoint() string {
+	return fmt.Sprintf("%s://%s@%s/%s", db.Provider, db.User, net.JoinHostPort(db.Host, strconv.Itoa(db.Port)), db.DatabaseName)
+}
+
+// SetComponentStatus records the deployment step of a component, keeping components in the order they were first reported.
+func (cp *ControlPlane) SetComponentStatus(status ComponentStatus) {
+	for idx := range cp.Status.Components {
+		if cp.Status.Components[idx].Name == status.Name {
+			cp.Status.Components[idx] = status
+
+			return
+		}
+	}
+
+	cp.Status.Components = append(cp.Status.Components, status)
+}
+
+// IsTLSEnabled reports whether the ioFog Controller API is served over HTTPS.
+func (ctrl *Controller) IsTLSEnabled() bool {
+	return ctrl.TLS != nil && ctrl.TLS.Mode != ""
+}
+
+// GetTLSSecretName returns the secret holding the certificate of the ioFog Controller.
+func (ctrl *Controller) GetTLSSecretName() string {
+	if ctrl.TLS == nil || ctrl.TLS.SecretName == "" {
+		return DefaultControllerTLSSecretName
+	}
+
+	return ctrl.TLS.SecretName
+}
+
+func (target *BackupTarget) IsS3() bool {
+	return target.S3.Bucket != ""
+}
+
 // +kubebuilder:object:root=true
 
 // ControlPlaneList contains a list of ControlPlane.
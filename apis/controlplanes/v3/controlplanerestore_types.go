@@ -0,0 +1,76 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	RestorePhasePending     = "pending"
+	RestorePhaseScalingDown = "scaling_down"
+	RestorePhaseRestoring   = "restoring"
+	RestorePhaseScalingUp   = "scaling_up"
+	RestorePhaseCompleted   = "completed"
+	RestorePhaseFailed      = "failed"
+)
+
+// ControlPlaneRestoreSpec defines the desired state of ControlPlaneRestore.
+type ControlPlaneRestoreSpec struct {
+	// ControlPlane is the name of the ControlPlane to restore, in the same namespace
+	ControlPlane string `json:"controlPlane"`
+	// Backup is the file name of the snapshot in the backup target
+	Backup string `json:"backup"`
+	// Target overrides the backup target of the ControlPlane
+	Target *BackupTarget `json:"target,omitempty"`
+}
+
+// ControlPlaneRestoreStatus defines the observed state of ControlPlaneRestore.
+type ControlPlaneRestoreStatus struct {
+	Phase          string       `json:"phase,omitempty"`
+	Message        string       `json:"message,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// ControlPlaneRestore is the Schema for the controlplanerestores API.
+type ControlPlaneRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ControlPlaneRestoreSpec   `json:"spec,omitempty"`
+	Status ControlPlaneRestoreStatus `json:"status,omitempty"`
+}
+
+func (restore *ControlPlaneRestore) IsFinished() bool {
+	return restore.Status.Phase == RestorePhaseCompleted || restore.Status.Phase == RestorePhaseFailed
+}
+
+// +kubebuilder:object:root=true
+
+// ControlPlaneRestoreList contains a list of ControlPlaneRestore.
+type ControlPlaneRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ControlPlaneRestore `json:"items"`
+}
+
+func init() { //nolint:gochecknoinits
+	SchemeBuilder.Register(&ControlPlaneRestore{}, &ControlPlaneRestoreList{})
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	agentFinalizer = "iofog.org/agent"
+	agentRunning   = "RUNNING"
+	// Agent states are polled from the ioFog Controller
+	statusPollDelay       = 30 * time.Second
+	controlPlaneWaitDelay = 10 * time.Second
+	provisionKeySecretKey = "key"
+	provisionKeyExpiryKey = "expirationTime"
+)
+
+// AgentReconciler reconciles an Agent object.
+type AgentReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=iofog.org,resources=agents,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=iofog.org,resources=agents/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=iofog.org,resources=controlplanes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+
+func (r *AgentReconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("agent", request.NamespacedName)
+
+	instance := &appsv3.Agent{}
+
+	err := r.Client.Get(ctx, request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	controller, err := iofog.GetController(ctx, r.Client, instance.Namespace, instance.Spec.ControlPlaneRef)
+
+	var clt *iofogclient.Client
+	if err == nil {
+		clt, err = iofog.NewClient(controller)
+	}
+
+	// Deprovision the Agent from the ioFog Controller before the Agent is deleted
+	if !instance.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(instance, agentFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		// Without a ControlPlane there is no ioFog Controller left to clean up
+		if goerrors.Is(err, iofog.ErrControlPlaneNotReady) {
+			return ctrl.Result{RequeueAfter: controlPlaneWaitDelay}, nil
+		} else if err != nil && !goerrors.Is(err, iofog.ErrControlPlaneNotFound) {
+			return ctrl.Result{}, err
+		}
+
+		if err == nil {
+			log.Info("Deprovisioning agent from ioFog Controller")
+
+			if err := deprovisionAgent(clt, instance); err != nil {
+				log.Error(err, "Failed to deprovision agent from ioFog Controller")
+
+				return ctrl.Result{}, err
+			}
+		}
+
+		controllerutil.RemoveFinalizer(instance, agentFinalizer)
+
+		return ctrl.Result{}, r.Client.Update(ctx, instance)
+	}
+
+	original := instance.Status.DeepCopy()
+
+	if err != nil {
+		log.Info("Waiting for ControlPlane", "reason", err.Error())
+		instance.SetCondition(appsv3.ConditionControlPlaneReady, metav1.ConditionFalse, iofog.GetControlPlaneReason(err), err.Error())
+
+		return ctrl.Result{RequeueAfter: controlPlaneWaitDelay}, r.updateStatus(ctx, instance, original)
+	}
+
+	instance.SetCondition(appsv3.ConditionControlPlaneReady, metav1.ConditionTrue, "ControlPlaneReady", "")
+
+	if !controllerutil.ContainsFinalizer(instance, agentFinalizer) {
+		controllerutil.AddFinalizer(instance, agentFinalizer)
+
+		if err := r.Client.Update(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	info, err := provisionAgent(clt, instance)
+	if err != nil {
+		log.Error(err, "Failed to provision agent in ioFog Controller")
+		instance.SetCondition(appsv3.ConditionProvisioned, metav1.ConditionFalse, "ProvisionFailed", err.Error())
+
+		if statusErr := r.updateStatus(ctx, instance, original); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	instance.Status.ObservedGeneration = instance.Generation
+	instance.SetCondition(appsv3.ConditionProvisioned, metav1.ConditionTrue, "Provisioned", "")
+	setAgentStatus(instance, info)
+
+	// The device needs a provision key until the Agent reports to the ioFog Controller for the first time
+	if info.LastStatusTime == 0 {
+		if err := r.reconcileProvisionKey(ctx, clt, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if info.DaemonStatus == agentRunning {
+		instance.SetCondition(appsv3.ConditionReady, metav1.ConditionTrue, "AgentRunning", "")
+	} else {
+		instance.SetCondition(appsv3.ConditionReady, metav1.ConditionFalse, "AgentNotRunning", fmt.Sprintf("Agent status is %s", info.DaemonStatus))
+	}
+
+	return ctrl.Result{RequeueAfter: statusPollDelay}, r.updateStatus(ctx, instance, original)
+}
+
+func (r *AgentReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&appsv3.Agent{}).
+		Owns(&corev1.Secret{}).
+		Watches(&source.Kind{Type: &cpv3.ControlPlane{}}, handler.EnqueueRequestsFromMapFunc(r.getControlPlaneAgents)).
+		Complete(r)
+}
+
+// getControlPlaneAgents requeues the Agents provisioned in a ControlPlane, so that they resume once it is ready.
+func (r *AgentReconciler) getControlPlaneAgents(obj client.Object) []reconcile.Request {
+	agents := &appsv3.AgentList{}
+	if err := r.Client.List(context.Background(), agents); err != nil {
+		r.Log.Error(err, "Failed to list agents", "ControlPlane.Namespace", obj.GetNamespace(), "ControlPlane.Name", obj.GetName())
+
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+
+	for idx := range agents.Items {
+		agent := &agents.Items[idx]
+		if !iofog.ReferencesControlPlane(agent.Namespace, agent.Spec.ControlPlaneRef, obj) {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: agent.Name, Namespace: agent.Namespace},
+		})
+	}
+
+	return requests
+}
+
+// reconcileProvisionKey keeps a valid provision key in a Secret owned by the Agent.
+func (r *AgentReconciler) reconcileProvisionKey(ctx context.Context, clt *iofogclient.Client, agent *appsv3.Agent) error {
+	name := fmt.Sprintf("%s-provision-key", agent.Name)
+	agent.Status.ProvisionKeySecret = name
+
+	found := &corev1.Secret{}
+
+	err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: agent.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	exists := err == nil
+
+	if exists {
+		expiry, parseErr := time.Parse(time.RFC3339, string(found.Data[provisionKeyExpiryKey]))
+		if parseErr == nil && time.Now().Before(expiry) {
+			return nil
+		}
+	}
+
+	key, err := clt.GetAgentProvisionKey(agent.Status.UUID)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: agent.Namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			provisionKeySecretKey: key.Key,
+			provisionKeyExpiryKey: time.UnixMilli(key.ExpireTime).UTC().Format(time.RFC3339),
+		},
+	}
+
+	// Set Agent instance as the owner and controller
+	if err := controllerutil.SetControllerReference(agent, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	if !exists {
+		r.Log.Info("Creating a new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+
+		return r.Client.Create(ctx, secret)
+	}
+
+	// Resource already exists - update it
+	secret.ResourceVersion = found.ResourceVersion
+
+	return r.Client.Update(ctx, secret)
+}
+
+// updateStatus writes the status subresource when it differs from original.
+func (r *AgentReconciler) updateStatus(ctx context.Context, agent *appsv3.Agent, original *appsv3.AgentStatus) error {
+	if reflect.DeepEqual(original, &agent.Status) {
+		return nil
+	}
+
+	if err := r.Status().Update(ctx, agent); err != nil {
+		r.Log.Error(err, "Failed to update agent status", "Agent.Namespace", agent.Namespace, "Agent.Name", agent.Name)
+
+		return err
+	}
+
+	return nil
+}
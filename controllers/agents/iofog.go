@@ -0,0 +1,162 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	agentFogTypeAuto = 0
+	agentFogTypeX86  = 1
+	agentFogTypeARM  = 2
+)
+
+func getAgentFogType(agent *appsv3.Agent) *int64 {
+	fogType := int64(agentFogTypeAuto)
+
+	switch agent.Spec.Architecture {
+	case appsv3.ArchitectureX86:
+		fogType = agentFogTypeX86
+	case appsv3.ArchitectureARM:
+		fogType = agentFogTypeARM
+	}
+
+	return &fogType
+}
+
+func newAgentUpdateRequest(agent *appsv3.Agent) iofogclient.AgentUpdateRequest {
+	config := &agent.Spec.Config
+	tags := agent.Spec.Tags
+
+	request := iofogclient.AgentUpdateRequest{
+		UUID:        agent.Status.UUID,
+		Name:        iofog.GetIofogName(agent.Namespace, agent.Spec.ControlPlaneRef, agent.Name),
+		Latitude:    config.Latitude,
+		Longitude:   config.Longitude,
+		Description: agent.Spec.Description,
+		FogType:     getAgentFogType(agent),
+		Tags:        &tags,
+		AgentConfiguration: iofogclient.AgentConfiguration{
+			DiskLimit:   config.DiskLimit,
+			CPULimit:    config.CPULimit,
+			MemoryLimit: config.MemoryLimit,
+		},
+	}
+
+	if agent.Spec.Host != "" {
+		request.Host = &agent.Spec.Host
+	}
+
+	if config.LogLevel != "" {
+		request.LogLevel = &config.LogLevel
+	}
+
+	if config.DockerURL != "" {
+		request.DockerURL = &config.DockerURL
+	}
+
+	return request
+}
+
+// getAgent returns the Agent from the ioFog Controller, or nil when it was not provisioned yet.
+func getAgent(clt *iofogclient.Client, agent *appsv3.Agent) (*iofogclient.AgentInfo, error) {
+	var info *iofogclient.AgentInfo
+
+	var err error
+
+	if agent.Status.UUID != "" {
+		info, err = clt.GetAgentByID(agent.Status.UUID)
+	} else {
+		info, err = clt.GetAgentByName(iofog.GetIofogName(agent.Namespace, agent.Spec.ControlPlaneRef, agent.Name), false)
+	}
+
+	if iofog.IsNotFound(err) {
+		return nil, nil
+	}
+
+	return info, err
+}
+
+// provisionAgent creates the Agent in the ioFog Controller, or updates it when its spec changed.
+func provisionAgent(clt *iofogclient.Client, agent *appsv3.Agent) (*iofogclient.AgentInfo, error) {
+	info, err := getAgent(clt, agent)
+	if err != nil {
+		return nil, err
+	}
+
+	if info == nil {
+		request := newAgentUpdateRequest(agent)
+
+		response, err := clt.CreateAgent(iofogclient.CreateAgentRequest{AgentUpdateRequest: request})
+		if err != nil {
+			return nil, err
+		}
+
+		agent.Status.UUID = response.UUID
+
+		return clt.GetAgentByID(response.UUID)
+	}
+
+	agent.Status.UUID = info.UUID
+
+	if agent.Generation == agent.Status.ObservedGeneration {
+		return info, nil
+	}
+
+	request := newAgentUpdateRequest(agent)
+
+	return clt.UpdateAgent(&request)
+}
+
+// deprovisionAgent deletes the Agent from the ioFog Controller. Agents that were never provisioned by the resource are left alone.
+func deprovisionAgent(clt *iofogclient.Client, agent *appsv3.Agent) error {
+	if agent.Status.UUID == "" {
+		return nil
+	}
+
+	info, err := getAgent(clt, agent)
+	if err != nil || info == nil {
+		return err
+	}
+
+	if err := clt.DeleteAgent(info.UUID); err != nil && !iofog.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+func setAgentStatus(agent *appsv3.Agent, info *iofogclient.AgentInfo) {
+	agent.Status.UUID = info.UUID
+	agent.Status.DaemonStatus = info.DaemonStatus
+	agent.Status.Version = info.Version
+	agent.Status.CPUUsage = info.CPUUsage
+	agent.Status.MemoryUsage = info.MemoryUsage
+	agent.Status.RunningMicroservices = info.RunningMicroservices
+	agent.Status.LastSeen = nil
+
+	if info.LastStatusTime > 0 {
+		lastSeen := metav1.NewTime(time.UnixMilli(info.LastStatusTime))
+		agent.Status.LastSeen = &lastSeen
+	}
+}
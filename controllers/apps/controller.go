@@ -18,21 +18,35 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
+	goerrors "errors"
 	"fmt"
 	"reflect"
+	"time"
 
 	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
-	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	applicationFinalizer = "iofog.org/application"
+	microserviceRunning  = "RUNNING"
+	// Microservice states are polled from the ioFog Controller
+	statusPollDelay       = 30 * time.Second
+	controlPlaneWaitDelay = 10 * time.Second
 )
 
 // ApplicationReconciler reconciles a Application object.
@@ -44,6 +58,9 @@ type ApplicationReconciler struct {
 
 // +kubebuilder:rbac:groups=iofog.org,resources=applications,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=iofog.org,resources=applications/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=iofog.org,resources=applicationtemplates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=iofog.org,resources=controlplanes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
 
 func (r *ApplicationReconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("application", request.NamespacedName)
@@ -59,189 +76,251 @@ func (r *ApplicationReconciler) Reconcile(ctx context.Context, request ctrl.Requ
 		return ctrl.Result{}, err
 	}
 
-	found := &appsv1.Deployment{}
+	controller, err := iofog.GetController(ctx, r.Client, instance.Namespace, instance.Spec.ControlPlaneRef)
 
-	err = r.Client.Get(ctx, types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}, found)
-	if err != nil && errors.IsNotFound(err) {
-		dep, err := r.deploymentForApp(instance)
-		if err != nil {
+	// Remove the application from the ioFog Controller before the Application is deleted
+	if !instance.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(instance, applicationFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		// Without a ControlPlane there is no ioFog Controller left to clean up
+		if goerrors.Is(err, iofog.ErrControlPlaneNotReady) {
+			return ctrl.Result{RequeueAfter: controlPlaneWaitDelay}, nil
+		} else if err != nil && !goerrors.Is(err, iofog.ErrControlPlaneNotFound) {
 			return ctrl.Result{}, err
 		}
 
-		log.Info("Creating a new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+		if err == nil {
+			log.Info("Deleting application from ioFog Controller")
 
-		err = r.Client.Create(ctx, dep)
-		if err != nil {
-			log.Error(err, "Failed to create new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+			if err := deleteApplication(controller, getIofogName(instance)); err != nil {
+				log.Error(err, "Failed to delete application from ioFog Controller")
 
-			return ctrl.Result{}, err
+				return ctrl.Result{}, err
+			}
 		}
 
-		return ctrl.Result{Requeue: true}, nil
-	} else if err != nil {
-		log.Error(err, "Failed to get Deployment")
+		controllerutil.RemoveFinalizer(instance, applicationFinalizer)
+
+		return ctrl.Result{}, r.Client.Update(ctx, instance)
+	}
+
+	original := instance.Status.DeepCopy()
+
+	if err != nil {
+		log.Info("Waiting for ControlPlane", "reason", err.Error())
+		instance.SetCondition(appsv3.ConditionControlPlaneReady, metav1.ConditionFalse, iofog.GetControlPlaneReason(err), err.Error())
+
+		return ctrl.Result{RequeueAfter: controlPlaneWaitDelay}, r.updateStatus(ctx, instance, original)
+	}
+
+	instance.SetCondition(appsv3.ConditionControlPlaneReady, metav1.ConditionTrue, "ControlPlaneReady", "")
 
+	if !controllerutil.ContainsFinalizer(instance, applicationFinalizer) {
+		controllerutil.AddFinalizer(instance, applicationFinalizer)
+
+		if err := r.Client.Update(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.deleteLegacyDeployment(ctx, instance); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	count := instance.Spec.Replicas
-	log.Info("Scaling", "Current count: ", *found.Spec.Replicas)
-	log.Info("Scaling", "Desired count: ", count)
+	templateHash := ""
 
-	if *found.Spec.Replicas != count {
-		found.Spec.Replicas = &count
+	if instance.Spec.TemplateRef != nil {
+		overridden := len(instance.Spec.Microservices) > 0
 
-		err = r.Client.Update(ctx, found)
-		if err != nil {
-			log.Error(err, "Failed to update Deployment", "Deployment.Namespace", instance.Namespace, "Deployment.Name", instance.Name)
+		if templateHash, err = r.expandTemplate(ctx, instance); err != nil {
+			log.Error(err, "Failed to expand application template")
+			instance.SetCondition(appsv3.ConditionTemplateValid, metav1.ConditionFalse, getTemplateReason(err), err.Error())
+
+			if statusErr := r.updateStatus(ctx, instance, original); statusErr != nil {
+				return ctrl.Result{}, statusErr
+			}
+
+			// The Application is requeued once it or its template changes
+			if isTemplateError(err) {
+				return ctrl.Result{}, nil
+			}
 
 			return ctrl.Result{}, err
 		}
 
-		return ctrl.Result{Requeue: true}, nil
+		instance.SetCondition(appsv3.ConditionTemplateValid, metav1.ConditionTrue, "TemplateExpanded", "")
+
+		if overridden {
+			instance.SetCondition(appsv3.ConditionTemplateOverridden, metav1.ConditionTrue, "MicroservicesSet",
+				"spec.microservices replaces the microservices and routes of the template")
+		} else {
+			meta.RemoveStatusCondition(&instance.Status.Conditions, appsv3.ConditionTemplateOverridden)
+		}
+	} else {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, appsv3.ConditionTemplateValid)
+		meta.RemoveStatusCondition(&instance.Status.Conditions, appsv3.ConditionTemplateOverridden)
 	}
 
-	podList := &corev1.PodList{}
+	// Creates the application, or rolls its microservices and routes out
+	requeueAfter := statusPollDelay
+
+	if instance.Generation != instance.Status.ObservedGeneration || instance.Status.TemplateHash != templateHash {
+		inProgress, err := r.rollout(controller, instance)
+		if err != nil {
+			log.Error(err, "Failed to deploy application to ioFog Controller")
+			reason := "DeployFailed"
+			if goerrors.Is(err, errPlacement) {
+				reason = "PlacementFailed"
+			}
+
+			instance.SetCondition(appsv3.ConditionDeployed, metav1.ConditionFalse, reason, err.Error())
+
+			if statusErr := r.updateStatus(ctx, instance, original); statusErr != nil {
+				return ctrl.Result{}, statusErr
+			}
+
+			return ctrl.Result{}, err
+		}
 
-	err = r.Client.List(ctx, podList)
+		if inProgress {
+			requeueAfter = rolloutPollDelay
+		} else {
+			instance.Status.TemplateHash = templateHash
+		}
+	}
+
+	microservices, err := getMicroserviceStatuses(controller, getIofogName(instance))
 	if err != nil {
-		log.Error(err, "Failed to list pods", "Deployment.Namespace", instance.Namespace, "Deployment.Name", instance.Name)
+		log.Error(err, "Failed to get microservices from ioFog Controller")
+		instance.SetCondition(appsv3.ConditionReady, metav1.ConditionUnknown, "StatusUnavailable", err.Error())
+
+		if statusErr := r.updateStatus(ctx, instance, original); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
 
 		return ctrl.Result{}, err
 	}
 
-	podNames := getPodNames(podList.Items)
+	instance.Status.Microservices = microservices
+	instance.Status.Replicas = getCurrentReplicas(instance, microservices)
+	instance.Status.LabelSelector = getLabelSelector(instance)
+	setReadyCondition(instance)
 
-	if !reflect.DeepEqual(podNames, instance.Status.PodNames) {
-		instance.Status.PodNames = podNames
+	return ctrl.Result{RequeueAfter: requeueAfter}, r.updateStatus(ctx, instance, original)
+}
 
-		err := r.Client.Update(ctx, instance)
-		if err != nil {
-			log.Error(err, "failed to update node status", "Deployment.Namespace", instance.Namespace, "Deployment.Name", instance.Name)
+// setReadyCondition marks the Application ready once every microservice runs on its Agent.
+func setReadyCondition(app *appsv3.Application) {
+	running := 0
 
-			return ctrl.Result{}, err
+	for idx := range app.Status.Microservices {
+		if app.Status.Microservices[idx].Status == microserviceRunning {
+			running++
 		}
 	}
 
-	return ctrl.Result{}, nil
+	total := len(app.Status.Microservices)
+	message := fmt.Sprintf("%d/%d microservices running", running, total)
+
+	switch {
+	case app.Spec.Replicas == 0 && total == 0:
+		app.SetCondition(appsv3.ConditionReady, metav1.ConditionTrue, "ScaledToZero", "")
+	case total > 0 && running == total:
+		app.SetCondition(appsv3.ConditionReady, metav1.ConditionTrue, "MicroservicesRunning", message)
+	default:
+		app.SetCondition(appsv3.ConditionReady, metav1.ConditionFalse, "MicroservicesNotRunning", message)
+	}
+}
+
+// updateStatus writes the status subresource when it differs from original.
+func (r *ApplicationReconciler) updateStatus(ctx context.Context, app *appsv3.Application, original *appsv3.ApplicationStatus) error {
+	if reflect.DeepEqual(original, &app.Status) {
+		return nil
+	}
+
+	if err := r.Status().Update(ctx, app); err != nil {
+		r.Log.Error(err, "Failed to update application status", "Application.Namespace", app.Namespace, "Application.Name", app.Name)
+
+		return err
+	}
+
+	return nil
 }
 
 func (r *ApplicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&appsv3.Application{}).
+		Watches(&source.Kind{Type: &appsv3.ApplicationTemplate{}}, handler.EnqueueRequestsFromMapFunc(r.getTemplateApplications)).
+		Watches(&source.Kind{Type: &cpv3.ControlPlane{}}, handler.EnqueueRequestsFromMapFunc(r.getControlPlaneApplications)).
 		Complete(r)
 }
 
-func getPodNames(pods []corev1.Pod) []string {
-	podNames := make([]string, len(pods))
-	for i := range pods {
-		podNames[i] = pods[i].Name
+// getTemplateApplications requeues the Applications expanding a template, so that template changes are rolled out.
+func (r *ApplicationReconciler) getTemplateApplications(obj client.Object) []reconcile.Request {
+	apps := &appsv3.ApplicationList{}
+	if err := r.Client.List(context.Background(), apps); err != nil {
+		r.Log.Error(err, "Failed to list applications", "ApplicationTemplate.Namespace", obj.GetNamespace(), "ApplicationTemplate.Name", obj.GetName())
+
+		return nil
 	}
 
-	return podNames
-}
+	requests := []reconcile.Request{}
+
+	for idx := range apps.Items {
+		app := &apps.Items[idx]
+		if app.Spec.TemplateRef == nil || getTemplateKey(app) != (types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}) {
+			continue
+		}
 
-func labelsForIOFog(name string) map[string]string {
-	return map[string]string{
-		"app": name,
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: app.Name, Namespace: app.Namespace},
+		})
 	}
+
+	return requests
 }
 
-func (r *ApplicationReconciler) deploymentForApp(app *appsv3.Application) (*appsv1.Deployment, error) {
-	labels := labelsForIOFog(app.Name)
+// getControlPlaneApplications requeues the Applications deployed to a ControlPlane, so that they resume once it is ready.
+func (r *ApplicationReconciler) getControlPlaneApplications(obj client.Object) []reconcile.Request {
+	apps := &appsv3.ApplicationList{}
+	if err := r.Client.List(context.Background(), apps); err != nil {
+		r.Log.Error(err, "Failed to list applications", "ControlPlane.Namespace", obj.GetNamespace(), "ControlPlane.Name", obj.GetName())
 
-	microservices, err := json.Marshal(app.Spec.Microservices)
-	if err != nil {
-		return nil, err
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+
+	for idx := range apps.Items {
+		app := &apps.Items[idx]
+		if !iofog.ReferencesControlPlane(app.Namespace, app.Spec.ControlPlaneRef, obj) {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: app.Name, Namespace: app.Namespace},
+		})
 	}
 
-	routes, err := json.Marshal(app.Spec.Routes)
+	return requests
+}
+
+// deleteLegacyDeployment removes the Kubernetes Deployment earlier versions of the operator created for each Application.
+func (r *ApplicationReconciler) deleteLegacyDeployment(ctx context.Context, app *appsv3.Application) error {
+	found := &appsv1.Deployment{}
+
+	err := r.Client.Get(ctx, types.NamespacedName{Name: app.Name, Namespace: app.Namespace}, found)
 	if err != nil {
-		return nil, err
+		return client.IgnoreNotFound(err)
 	}
 
-	annotations := map[string]string{
-		"microservices": string(microservices),
-		"routes":        string(routes),
+	if !metav1.IsControlledBy(found, app) {
+		return nil
 	}
 
-	containers := make([]corev1.Container, len(app.Spec.Microservices))
+	r.Log.Info("Deleting legacy Deployment", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
 
-	for i := range app.Spec.Microservices {
-		microservice := &app.Spec.Microservices[i]
-		container := corev1.Container{
-			Name:  microservice.Name,
-			Image: fmt.Sprintf("%s, %s", microservice.Images.X86, microservice.Images.ARM),
-		}
-		containers[i] = container
-	}
-
-	dep := &appsv1.Deployment{
-		TypeMeta: metav1.TypeMeta{
-			APIVersion: "apps/v1",
-			Kind:       "Deployment",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      app.ObjectMeta.Name,
-			Namespace: app.ObjectMeta.Namespace,
-		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &app.Spec.Replicas,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: labels,
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels:      labels,
-					Annotations: annotations,
-				},
-				Spec: corev1.PodSpec{
-					Tolerations: []corev1.Toleration{
-						{
-							Key:      "resource-type",
-							Operator: corev1.TolerationOpEqual,
-							Value:    "iofog-custom-resource",
-							Effect:   corev1.TaintEffectNoSchedule,
-						},
-					},
-					Affinity: &corev1.Affinity{
-						NodeAffinity: &corev1.NodeAffinity{
-							RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
-								NodeSelectorTerms: []corev1.NodeSelectorTerm{
-									{
-										MatchExpressions: []corev1.NodeSelectorRequirement{
-											{
-												Key:      "type",
-												Operator: corev1.NodeSelectorOpIn,
-												Values:   []string{"iofog-kubelet"},
-											},
-										},
-									},
-								},
-							},
-						},
-						PodAntiAffinity: &corev1.PodAntiAffinity{
-							RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
-								{
-									LabelSelector: &metav1.LabelSelector{
-										MatchExpressions: []metav1.LabelSelectorRequirement{
-											{
-												Key:      "app",
-												Operator: metav1.LabelSelectorOpIn,
-												Values:   []string{app.ObjectMeta.Name},
-											},
-										},
-									},
-									TopologyKey: "kubernetes.io/hostname",
-								},
-							},
-						},
-					},
-					Containers: containers,
-				},
-			},
-		},
-	}
-
-	return dep, controllerutil.SetControllerReference(app, dep, r.Scheme)
+	return client.IgnoreNotFound(r.Client.Delete(ctx, found))
 }
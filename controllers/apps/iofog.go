@@ -0,0 +1,110 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	iofogapps "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/apps"
+	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func deployApplication(controller iofogapps.IofogController, app *iofogapps.Application) error {
+	return iofogapps.DeployApplication(controller, *app)
+}
+
+func deleteApplication(controller iofogapps.IofogController, name string) error {
+	clt, err := iofog.NewClient(controller)
+	if err != nil {
+		return err
+	}
+
+	if err := clt.DeleteApplication(name); err != nil && !iofog.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// getMicroserviceStatuses reports where each microservice of the application runs and in which state.
+func getMicroserviceStatuses(controller iofogapps.IofogController, name string) ([]appsv3.MicroserviceStatus, error) {
+	clt, err := iofog.NewClient(controller)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := clt.GetMicroservicesByApplication(name)
+	if err != nil {
+		return nil, err
+	}
+
+	agents := map[string]*iofogclient.AgentInfo{}
+	statuses := make([]appsv3.MicroserviceStatus, len(response.Microservices))
+
+	for i := range response.Microservices {
+		msvc := &response.Microservices[i]
+
+		agent, found := agents[msvc.AgentUUID]
+		if !found && msvc.AgentUUID != "" {
+			agent, err = clt.GetAgentByID(msvc.AgentUUID)
+			if err != nil {
+				return nil, err
+			}
+
+			agents[msvc.AgentUUID] = agent
+		}
+
+		statuses[i] = appsv3.MicroserviceStatus{
+			Name:         msvc.Name,
+			UUID:         msvc.UUID,
+			Image:        getMicroserviceImage(msvc, agent),
+			Status:       msvc.Status.Status,
+			ErrorMessage: msvc.Status.ErrorMessage,
+		}
+
+		if agent != nil {
+			statuses[i].Agent = agent.Name
+		}
+
+		if msvc.Status.StartTime > 0 {
+			startTime := metav1.NewTime(time.UnixMilli(msvc.Status.StartTime))
+			statuses[i].StartTime = &startTime
+		}
+	}
+
+	return statuses, nil
+}
+
+// getMicroserviceImage returns the image matching the architecture of the Agent running the microservice.
+func getMicroserviceImage(msvc *iofogclient.MicroserviceInfo, agent *iofogclient.AgentInfo) string {
+	if len(msvc.Images) == 0 {
+		return ""
+	}
+
+	if agent != nil {
+		for _, image := range msvc.Images {
+			if int64(image.AgentTypeID) == agent.FogType {
+				return image.ContainerImage
+			}
+		}
+	}
+
+	return msvc.Images[0].ContainerImage
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	iofogapps "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/apps"
+	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	agentRunning      = "RUNNING"
+	agentFogTypeX86   = 1
+	agentFogTypeARM   = 2
+	agentTagSeparator = "="
+)
+
+var errPlacement = errors.New("placement failed")
+
+func listAgents(controller iofogapps.IofogController) ([]iofogclient.AgentInfo, error) {
+	clt, err := iofog.NewClient(controller)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := clt.ListAgents(iofogclient.ListAgentsRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Agents, nil
+}
+
+func getAgentLabels(agent *iofogclient.AgentInfo) labels.Set {
+	set := labels.Set{}
+	if agent.Tags == nil {
+		return set
+	}
+
+	for _, tag := range *agent.Tags {
+		key, value, _ := strings.Cut(tag, agentTagSeparator)
+		set[key] = value
+	}
+
+	return set
+}
+
+func getAgentArchitecture(agent *iofogclient.AgentInfo) string {
+	switch agent.FogType {
+	case agentFogTypeX86:
+		return appsv3.ArchitectureX86
+	case agentFogTypeARM:
+		return appsv3.ArchitectureARM
+	default:
+		return ""
+	}
+}
+
+// getCandidateAgents returns the Agents satisfying placement, running Agents first.
+func getCandidateAgents(agents []iofogclient.AgentInfo, placement *appsv3.MicroservicePlacement) ([]*iofogclient.AgentInfo, error) {
+	selector := labels.Everything()
+
+	if placement.AgentSelector != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(placement.AgentSelector); err != nil {
+			return nil, fmt.Errorf("%w: invalid Agent selector for microservice %s: %s", errPlacement, placement.Microservice, err.Error())
+		}
+	}
+
+	candidates := []*iofogclient.AgentInfo{}
+
+	for idx := range agents {
+		agent := &agents[idx]
+
+		if placement.Agent != "" && agent.Name != placement.Agent {
+			continue
+		}
+
+		// Agents which have not reported their architecture yet can run either
+		arch := getAgentArchitecture(agent)
+		if placement.Architecture != "" && arch != "" && arch != placement.Architecture {
+			continue
+		}
+
+		if !selector.Matches(getAgentLabels(agent)) {
+			continue
+		}
+
+		candidates = append(candidates, agent)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		iRunning, jRunning := candidates[i].DaemonStatus == agentRunning, candidates[j].DaemonStatus == agentRunning
+		if iRunning != jRunning {
+			return iRunning
+		}
+
+		return candidates[i].Name < candidates[j].Name
+	})
+
+	return candidates, nil
+}
+
+func hasMicroservice(app *appsv3.Application, name string) bool {
+	for idx := range app.Spec.Microservices {
+		if app.Spec.Microservices[idx].Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getPlacement(app *appsv3.Application, microservice string) *appsv3.MicroservicePlacement {
+	for idx := range app.Spec.Placement {
+		if app.Spec.Placement[idx].Microservice == microservice {
+			return &app.Spec.Placement[idx]
+		}
+	}
+
+	return nil
+}
+
+// resolvePlacements chooses the Agent of each microservice replica and records it in the status of app.
+// Replicas are spread across the candidate Agents, and earlier choices are kept while they remain valid.
+func resolvePlacements(controller iofogapps.IofogController, app *appsv3.Application) error {
+	for idx := range app.Spec.Placement {
+		if !hasMicroservice(app, app.Spec.Placement[idx].Microservice) {
+			return fmt.Errorf("%w: placement refers to unknown microservice %s", errPlacement, app.Spec.Placement[idx].Microservice)
+		}
+	}
+
+	// Replicas of a microservice pinned to the Agent of its spec would all run there, competing for its ports and volumes
+	if app.Spec.Replicas > 1 {
+		for idx := range app.Spec.Microservices {
+			if getPlacement(app, app.Spec.Microservices[idx].Name) == nil {
+				return fmt.Errorf("%w: %d replicas of microservice %s require a placement to spread them across Agents",
+					errPlacement, app.Spec.Replicas, app.Spec.Microservices[idx].Name)
+			}
+		}
+	}
+
+	agents, err := listAgents(controller)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool, len(agents))
+	for idx := range agents {
+		known[agents[idx].Name] = true
+	}
+
+	previous := make(map[string]string, len(app.Status.Placements))
+	for _, placement := range app.Status.Placements {
+		previous[placement.Microservice] = placement.Agent
+	}
+
+	placements := []appsv3.PlacementStatus{}
+
+	for replica := int32(0); replica < app.Spec.Replicas; replica++ {
+		for idx := range app.Spec.Microservices {
+			msvc := &app.Spec.Microservices[idx]
+			name := getReplicaName(msvc.Name, replica)
+
+			placement := getPlacement(app, msvc.Name)
+			if placement == nil {
+				if !known[msvc.Agent.Name] {
+					return fmt.Errorf("%w: Agent %s of microservice %s is unknown to the ioFog Controller", errPlacement, msvc.Agent.Name, msvc.Name)
+				}
+
+				placements = append(placements, appsv3.PlacementStatus{Microservice: name, Agent: msvc.Agent.Name})
+
+				continue
+			}
+
+			candidates, err := getCandidateAgents(agents, placement)
+			if err != nil {
+				return err
+			}
+
+			if len(candidates) > 0 {
+				agent := candidates[int(replica)%len(candidates)].Name
+
+				for _, candidate := range candidates {
+					if candidate.Name == previous[name] {
+						agent = candidate.Name
+					}
+				}
+
+				placements = append(placements, appsv3.PlacementStatus{Microservice: name, Agent: agent})
+
+				continue
+			}
+
+			fallback := ""
+
+			for _, agent := range placement.FallbackAgents {
+				if known[agent] {
+					fallback = agent
+
+					break
+				}
+			}
+
+			if fallback == "" {
+				return fmt.Errorf("%w: no Agent satisfies the placement of microservice %s", errPlacement, msvc.Name)
+			}
+
+			placements = append(placements, appsv3.PlacementStatus{Microservice: name, Agent: fallback, Fallback: true})
+		}
+	}
+
+	app.Status.Placements = placements
+
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	iofogapps "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/apps"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func labelsForIOFog(name string) map[string]string {
+	return map[string]string{
+		"app": name,
+	}
+}
+
+// getLabelSelector is exposed through the scale subresource so that HPAs can select the metrics of the Application,
+// which microservices do not report as pods, e.g. Pods or External metrics labelled app=<name>.
+func getLabelSelector(app *appsv3.Application) string {
+	return labels.SelectorFromSet(labelsForIOFog(app.Name)).String()
+}
+
+// getReplicaName keeps the names of the first replica so that scaling does not redeploy existing microservices.
+func getReplicaName(name string, replica int32) string {
+	if replica == 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s-%d", name, replica)
+}
+
+// getIofogName returns the name of the application on the ioFog Controller.
+func getIofogName(app *appsv3.Application) string {
+	return iofog.GetIofogName(app.Namespace, app.Spec.ControlPlaneRef, app.Name)
+}
+
+// getDesiredApplication returns the application to deploy on the ioFog Controller.
+// Each replica is a copy of the microservices of the spec, with its routes connecting its own microservices,
+// running on the Agent recorded by resolvePlacements.
+func getDesiredApplication(app *appsv3.Application) iofogapps.Application {
+	desired := iofogapps.Application{
+		Name:          getIofogName(app),
+		Microservices: make([]iofogapps.Microservice, 0, int(app.Spec.Replicas)*len(app.Spec.Microservices)),
+		Routes:        make([]iofogapps.Route, 0, int(app.Spec.Replicas)*len(app.Spec.Routes)),
+	}
+
+	placements := make(map[string]string, len(app.Status.Placements))
+	for _, placement := range app.Status.Placements {
+		placements[placement.Microservice] = placement.Agent
+	}
+
+	for replica := int32(0); replica < app.Spec.Replicas; replica++ {
+		for idx := range app.Spec.Microservices {
+			msvc := *app.Spec.Microservices[idx].DeepCopy()
+			msvc.Name = getReplicaName(msvc.Name, replica)
+
+			if agent, found := placements[msvc.Name]; found {
+				msvc.Agent.Name = agent
+			}
+
+			desired.Microservices = append(desired.Microservices, msvc)
+		}
+
+		for idx := range app.Spec.Routes {
+			route := app.Spec.Routes[idx]
+			route.Name = getReplicaName(route.Name, replica)
+			route.From = getReplicaName(route.From, replica)
+			route.To = getReplicaName(route.To, replica)
+			desired.Routes = append(desired.Routes, route)
+		}
+	}
+
+	return desired
+}
+
+// getCurrentReplicas counts the replicas whose microservices are all deployed on the ioFog Controller.
+func getCurrentReplicas(app *appsv3.Application, microservices []appsv3.MicroserviceStatus) int32 {
+	deployed := make(map[string]bool, len(microservices))
+	for idx := range microservices {
+		deployed[microservices[idx].Name] = true
+	}
+
+	var replicas int32
+
+	for replica := int32(0); replica < app.Spec.Replicas; replica++ {
+		complete := true
+
+		for idx := range app.Spec.Microservices {
+			if !deployed[getReplicaName(app.Spec.Microservices[idx].Name, replica)] {
+				complete = false
+
+				break
+			}
+		}
+
+		if complete {
+			replicas++
+		}
+	}
+
+	return replicas
+}
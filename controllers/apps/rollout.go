@@ -0,0 +1,230 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	iofogapps "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/apps"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Agents are given at least this long to restart their microservices before the rollout moves on
+	rolloutPollDelay = 10 * time.Second
+	// Agents taking longer to run their updated microservices stall the rollout
+	defaultProgressDeadlineSeconds = 600
+)
+
+func getUpdateStrategy(app *appsv3.Application) string {
+	if app.Spec.UpdateStrategy.Type == "" {
+		return appsv3.UpdateStrategyRollingUpdate
+	}
+
+	return app.Spec.UpdateStrategy.Type
+}
+
+func getProgressDeadline(app *appsv3.Application) time.Duration {
+	seconds := int32(defaultProgressDeadlineSeconds)
+	if app.Spec.UpdateStrategy.ProgressDeadlineSeconds != nil {
+		seconds = *app.Spec.UpdateStrategy.ProgressDeadlineSeconds
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func getMicroserviceHashes(desired *iofogapps.Application) (map[string]string, error) {
+	hashes := make(map[string]string, len(desired.Microservices))
+
+	for idx := range desired.Microservices {
+		msvc := &desired.Microservices[idx]
+
+		spec, err := json.Marshal(msvc)
+		if err != nil {
+			return nil, err
+		}
+
+		hash := fnv.New32a()
+		_, _ = hash.Write(spec)
+		hashes[msvc.Name] = fmt.Sprintf("%x", hash.Sum32())
+	}
+
+	return hashes, nil
+}
+
+// getChangedAgents returns the Agents running a microservice whose spec changed since the last rollout, sorted by name.
+func getChangedAgents(desired *iofogapps.Application, deployed, hashes map[string]string) []string {
+	agents := []string{}
+	seen := map[string]bool{}
+
+	for idx := range desired.Microservices {
+		msvc := &desired.Microservices[idx]
+		if hashes[msvc.Name] == deployed[msvc.Name] || seen[msvc.Agent.Name] {
+			continue
+		}
+
+		seen[msvc.Agent.Name] = true
+		agents = append(agents, msvc.Agent.Name)
+	}
+
+	sort.Strings(agents)
+
+	return agents
+}
+
+// rollout applies the spec of app to the ioFog Controller following its update strategy.
+// It reports whether the rollout is still in progress and must be resumed later.
+func (r *ApplicationReconciler) rollout(controller iofogapps.IofogController, app *appsv3.Application) (bool, error) {
+	// Agents are chosen once per rollout so that a rolling update does not move microservices midway
+	if app.Status.Rollout == nil || app.Status.Rollout.Generation != app.Generation {
+		if err := resolvePlacements(controller, app); err != nil {
+			return false, err
+		}
+	}
+
+	desired := getDesiredApplication(app)
+
+	hashes, err := getMicroserviceHashes(&desired)
+	if err != nil {
+		return false, err
+	}
+
+	strategy := getUpdateStrategy(app)
+	log := r.Log.WithValues("application", fmt.Sprintf("%s/%s", app.Namespace, app.Name), "strategy", strategy)
+
+	// The first deployment has nothing to roll over
+	if app.Status.ObservedGeneration == 0 {
+		log.Info("Deploying application to ioFog Controller")
+
+		return false, r.completeRollout(controller, app, &desired, hashes)
+	}
+
+	if strategy == appsv3.UpdateStrategyRecreate {
+		log.Info("Recreating application on ioFog Controller")
+
+		if err := deleteApplication(controller, getIofogName(app)); err != nil {
+			return false, err
+		}
+
+		return false, r.completeRollout(controller, app, &desired, hashes)
+	}
+
+	if app.Status.Rollout == nil || app.Status.Rollout.Generation != app.Generation {
+		app.Status.Rollout = &appsv3.RolloutStatus{
+			Generation:    app.Generation,
+			Strategy:      strategy,
+			PendingAgents: getChangedAgents(&desired, app.Status.DeployedHashes, hashes),
+		}
+	}
+
+	rollout := app.Status.Rollout
+
+	if rollout.CurrentAgent != "" {
+		updated, err := isAgentUpdated(controller, app, rollout)
+		if err != nil {
+			return true, err
+		}
+
+		if !updated {
+			// Like Deployments, the rollout keeps waiting for the Agent but reports that it is stuck
+			deadline := getProgressDeadline(app)
+			if rollout.CurrentAgentStartTime != nil && time.Since(rollout.CurrentAgentStartTime.Time) > deadline {
+				log.Info(fmt.Sprintf("Agent %s exceeded its progress deadline", rollout.CurrentAgent))
+				app.SetCondition(appsv3.ConditionProgressing, metav1.ConditionFalse, "ProgressDeadlineExceeded",
+					fmt.Sprintf("Agent %s did not run its updated microservices within %s", rollout.CurrentAgent, deadline))
+			}
+
+			return true, nil
+		}
+
+		rollout.UpdatedAgents = append(rollout.UpdatedAgents, rollout.CurrentAgent)
+		rollout.CurrentAgent = ""
+		rollout.CurrentAgentStartTime = nil
+	}
+
+	if len(rollout.PendingAgents) == 0 {
+		log.Info("Completing rollout on ioFog Controller")
+
+		return false, r.completeRollout(controller, app, &desired, hashes)
+	}
+
+	agent := rollout.PendingAgents[0]
+	log.Info(fmt.Sprintf("Updating microservices on Agent %s", agent))
+
+	for idx := range desired.Microservices {
+		msvc := desired.Microservices[idx]
+		if msvc.Agent.Name != agent || hashes[msvc.Name] == app.Status.DeployedHashes[msvc.Name] {
+			continue
+		}
+
+		msvc.Application = &desired.Name
+		if err := iofogapps.DeployMicroservice(controller, msvc); err != nil {
+			return false, err
+		}
+	}
+
+	now := metav1.Now()
+	rollout.PendingAgents = rollout.PendingAgents[1:]
+	rollout.CurrentAgent = agent
+	rollout.CurrentAgentStartTime = &now
+
+	total := len(rollout.UpdatedAgents) + len(rollout.PendingAgents) + 1
+	app.SetCondition(appsv3.ConditionProgressing, metav1.ConditionTrue, "RollingUpdate",
+		fmt.Sprintf("Updating Agent %s, %d/%d Agents updated", agent, len(rollout.UpdatedAgents), total))
+
+	return true, nil
+}
+
+// isAgentUpdated reports whether every microservice of app on the Agent being updated is running again.
+func isAgentUpdated(controller iofogapps.IofogController, app *appsv3.Application, rollout *appsv3.RolloutStatus) (bool, error) {
+	if rollout.CurrentAgentStartTime != nil && time.Since(rollout.CurrentAgentStartTime.Time) < rolloutPollDelay {
+		return false, nil
+	}
+
+	microservices, err := getMicroserviceStatuses(controller, getIofogName(app))
+	if err != nil {
+		return false, err
+	}
+
+	for idx := range microservices {
+		if microservices[idx].Agent == rollout.CurrentAgent && microservices[idx].Status != microserviceRunning {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// completeRollout deploys the whole spec, which also applies the routes and removes microservices no longer in the spec.
+func (r *ApplicationReconciler) completeRollout(controller iofogapps.IofogController, app *appsv3.Application, desired *iofogapps.Application, hashes map[string]string) error {
+	if err := deployApplication(controller, desired); err != nil {
+		return err
+	}
+
+	app.Status.ObservedGeneration = app.Generation
+	app.Status.DeployedHashes = hashes
+	app.Status.Rollout = nil
+	app.SetCondition(appsv3.ConditionDeployed, metav1.ConditionTrue, "Deployed", "")
+	app.SetCondition(appsv3.ConditionProgressing, metav1.ConditionFalse, "RolloutComplete", "")
+
+	return nil
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var (
+	errMissingVariable = errors.New("missing template variable")
+	errUnknownVariable = errors.New("unknown template variable")
+	errInvalidVariable = errors.New("invalid template variable")
+	errInvalidTemplate = errors.New("invalid template")
+	errTemplateDenied  = errors.New("template does not allow the namespace")
+)
+
+var variableReference = regexp.MustCompile(`{{\s*([A-Za-z_][A-Za-z0-9_]*)\s*}}`)
+
+// getTemplateReason returns the reason of the TemplateValid condition for an error of expandTemplate.
+func getTemplateReason(err error) string {
+	switch {
+	case k8serrors.IsNotFound(err):
+		return "TemplateNotFound"
+	case errors.Is(err, errTemplateDenied):
+		return "TemplateNotAllowed"
+	case errors.Is(err, errMissingVariable):
+		return "MissingVariable"
+	case errors.Is(err, errUnknownVariable):
+		return "UnknownVariable"
+	case errors.Is(err, errInvalidVariable):
+		return "InvalidVariable"
+	case errors.Is(err, errInvalidTemplate):
+		return "InvalidTemplate"
+	default:
+		return "TemplateUnavailable"
+	}
+}
+
+// isTemplateError reports whether err can only be fixed by changing the Application or its template.
+func isTemplateError(err error) bool {
+	return getTemplateReason(err) != "TemplateUnavailable"
+}
+
+func getTemplateKey(app *appsv3.Application) types.NamespacedName {
+	key := types.NamespacedName{Name: app.Spec.TemplateRef.Name, Namespace: app.Spec.TemplateRef.Namespace}
+	if key.Namespace == "" {
+		key.Namespace = app.Namespace
+	}
+
+	return key
+}
+
+func decodeJSON(data []byte, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return decoder.Decode(value)
+}
+
+func checkVariableType(variable *appsv3.TemplateVariable, value interface{}) error {
+	valid := false
+
+	switch variable.Type {
+	case appsv3.VariableTypeInteger:
+		if number, ok := value.(json.Number); ok {
+			_, err := number.Int64()
+			valid = err == nil
+		}
+	case appsv3.VariableTypeNumber:
+		_, valid = value.(json.Number)
+	case appsv3.VariableTypeBoolean:
+		_, valid = value.(bool)
+	default:
+		_, valid = value.(string)
+	}
+
+	if !valid {
+		return fmt.Errorf("%w: %s must be of type %s", errInvalidVariable, variable.Name, getVariableType(variable))
+	}
+
+	return nil
+}
+
+func getVariableType(variable *appsv3.TemplateVariable) string {
+	if variable.Type == "" {
+		return appsv3.VariableTypeString
+	}
+
+	return variable.Type
+}
+
+// getVariableValues returns the value of each variable of the template, from the Application or the template defaults.
+func getVariableValues(template *appsv3.ApplicationTemplate, app *appsv3.Application) (map[string]interface{}, error) {
+	variables := make(map[string]*appsv3.TemplateVariable, len(template.Spec.Variables))
+	values := make(map[string]interface{}, len(template.Spec.Variables))
+
+	for idx := range template.Spec.Variables {
+		variable := &template.Spec.Variables[idx]
+		variables[variable.Name] = variable
+
+		if variable.Default == nil {
+			continue
+		}
+
+		var value interface{}
+		if err := decodeJSON(variable.Default.Raw, &value); err != nil {
+			return nil, fmt.Errorf("%w: default of variable %s: %s", errInvalidTemplate, variable.Name, err.Error())
+		}
+
+		if err := checkVariableType(variable, value); err != nil {
+			return nil, fmt.Errorf("%w: default of variable %s must be of type %s", errInvalidTemplate, variable.Name, getVariableType(variable))
+		}
+
+		values[variable.Name] = value
+	}
+
+	for idx := range app.Spec.Variables {
+		name := app.Spec.Variables[idx].Name
+
+		variable, found := variables[name]
+		if !found {
+			return nil, fmt.Errorf("%w: %s is not a variable of template %s", errUnknownVariable, name, template.Name)
+		}
+
+		var value interface{}
+		if err := decodeJSON(app.Spec.Variables[idx].Value.Raw, &value); err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", errInvalidVariable, name, err.Error())
+		}
+
+		if err := checkVariableType(variable, value); err != nil {
+			return nil, err
+		}
+
+		values[name] = value
+	}
+
+	missing := []string{}
+
+	for name := range variables {
+		if _, found := values[name]; !found {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+
+		return nil, fmt.Errorf("%w: %s", errMissingVariable, strings.Join(missing, ", "))
+	}
+
+	return values, nil
+}
+
+// expandValue replaces the variable references in the strings of value.
+func expandValue(value interface{}, values map[string]interface{}) (interface{}, error) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			expanded, err := expandValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+
+			typed[key] = expanded
+		}
+
+		return typed, nil
+	case []interface{}:
+		for idx, item := range typed {
+			expanded, err := expandValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+
+			typed[idx] = expanded
+		}
+
+		return typed, nil
+	case string:
+		return expandString(typed, values)
+	default:
+		return value, nil
+	}
+}
+
+func expandString(value string, values map[string]interface{}) (interface{}, error) {
+	for _, match := range variableReference.FindAllStringSubmatch(value, -1) {
+		if _, found := values[match[1]]; !found {
+			return nil, fmt.Errorf("%w: %s refers to undeclared variable %s", errInvalidTemplate, value, match[1])
+		}
+	}
+
+	// A single reference keeps the type of the variable, e.g. for ports
+	if match := variableReference.FindStringSubmatch(value); match != nil && match[0] == value {
+		return values[match[1]], nil
+	}
+
+	return variableReference.ReplaceAllStringFunc(value, func(reference string) string {
+		return fmt.Sprint(values[variableReference.FindStringSubmatch(reference)[1]])
+	}), nil
+}
+
+// expandTemplate fills the spec of app in from its template, and returns a hash of the expanded template.
+// The spec is only changed in memory, the Application keeps referring to the template.
+func (r *ApplicationReconciler) expandTemplate(ctx context.Context, app *appsv3.Application) (string, error) {
+	template := &appsv3.ApplicationTemplate{}
+	if err := r.Client.Get(ctx, getTemplateKey(app), template); err != nil {
+		return "", err
+	}
+
+	if !template.AllowsNamespace(app.Namespace) {
+		return "", fmt.Errorf("%w: %s/%s does not list %s in spec.allowedNamespaces", errTemplateDenied, template.Namespace, template.Name, app.Namespace)
+	}
+
+	values, err := getVariableValues(template, app)
+	if err != nil {
+		return "", err
+	}
+
+	var spec interface{}
+	if err := decodeJSON(template.Spec.Application.Raw, &spec); err != nil {
+		return "", fmt.Errorf("%w: %s: %s", errInvalidTemplate, template.Name, err.Error())
+	}
+
+	if spec, err = expandValue(spec, values); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+
+	expanded := appsv3.ApplicationSpec{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&expanded); err != nil {
+		return "", fmt.Errorf("%w: %s does not expand to an application: %s", errInvalidTemplate, template.Name, err.Error())
+	}
+
+	if len(app.Spec.Microservices) == 0 {
+		app.Spec.Microservices = expanded.Microservices
+		app.Spec.Routes = expanded.Routes
+	}
+
+	if len(app.Spec.Placement) == 0 {
+		app.Spec.Placement = expanded.Placement
+	}
+
+	if app.Spec.UpdateStrategy.Type == "" {
+		app.Spec.UpdateStrategy = expanded.UpdateStrategy
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write(data)
+
+	return fmt.Sprintf("%x", hash.Sum32()), nil
+}
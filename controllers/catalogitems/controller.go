@@ -0,0 +1,249 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	catalogItemFinalizer  = "iofog.org/catalogitem"
+	controlPlaneWaitDelay = 10 * time.Second
+)
+
+var errRegistryNotSynced = goerrors.New("registry is not synchronized with the ioFog Controller")
+
+// CatalogItemReconciler reconciles a CatalogItem object.
+type CatalogItemReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=iofog.org,resources=catalogitems,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=iofog.org,resources=catalogitems/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=iofog.org,resources=registries,verbs=get;list;watch
+// +kubebuilder:rbac:groups=iofog.org,resources=controlplanes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+
+func (r *CatalogItemReconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("catalogitem", request.NamespacedName)
+
+	instance := &appsv3.CatalogItem{}
+
+	err := r.Client.Get(ctx, request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	controller, err := iofog.GetController(ctx, r.Client, instance.Namespace, instance.Spec.ControlPlaneRef)
+
+	var clt *iofogclient.Client
+	if err == nil {
+		clt, err = iofog.NewClient(controller)
+	}
+
+	// Remove the item from the catalog of the ioFog Controller before the CatalogItem is deleted
+	if !instance.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(instance, catalogItemFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		// Without a ControlPlane there is no ioFog Controller left to clean up
+		if goerrors.Is(err, iofog.ErrControlPlaneNotReady) {
+			return ctrl.Result{RequeueAfter: controlPlaneWaitDelay}, nil
+		} else if err != nil && !goerrors.Is(err, iofog.ErrControlPlaneNotFound) {
+			return ctrl.Result{}, err
+		}
+
+		if err == nil {
+			log.Info("Deleting catalog item from ioFog Controller")
+
+			if err := deleteCatalogItem(clt, instance); err != nil {
+				log.Error(err, "Failed to delete catalog item from ioFog Controller")
+
+				return ctrl.Result{}, err
+			}
+		}
+
+		controllerutil.RemoveFinalizer(instance, catalogItemFinalizer)
+
+		return ctrl.Result{}, r.Client.Update(ctx, instance)
+	}
+
+	original := instance.Status.DeepCopy()
+
+	if err != nil {
+		log.Info("Waiting for ControlPlane", "reason", err.Error())
+		instance.SetCondition(appsv3.ConditionControlPlaneReady, metav1.ConditionFalse, iofog.GetControlPlaneReason(err), err.Error())
+
+		return ctrl.Result{RequeueAfter: controlPlaneWaitDelay}, r.updateStatus(ctx, instance, original)
+	}
+
+	instance.SetCondition(appsv3.ConditionControlPlaneReady, metav1.ConditionTrue, "ControlPlaneReady", "")
+
+	if !controllerutil.ContainsFinalizer(instance, catalogItemFinalizer) {
+		controllerutil.AddFinalizer(instance, catalogItemFinalizer)
+
+		if err := r.Client.Update(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	registryID, reason, err := r.getRegistryID(ctx, instance)
+	if err == nil {
+		reason = "SyncFailed"
+		err = syncCatalogItem(clt, instance, registryID)
+	}
+
+	if err != nil {
+		log.Error(err, "Failed to synchronize catalog item with ioFog Controller")
+
+		if goerrors.Is(err, errInvalidSpec) {
+			reason = "InvalidSpec"
+		}
+
+		instance.SetCondition(appsv3.ConditionSynced, metav1.ConditionFalse, reason, err.Error())
+
+		if statusErr := r.updateStatus(ctx, instance, original); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	instance.Status.ObservedGeneration = instance.Generation
+	instance.SetCondition(appsv3.ConditionSynced, metav1.ConditionTrue, "Synced", "")
+
+	return ctrl.Result{}, r.updateStatus(ctx, instance, original)
+}
+
+// getRegistryID returns the ID of the registry of the item in the ioFog Controller,
+// and the reason of the Synced condition when it is unavailable.
+func (r *CatalogItemReconciler) getRegistryID(ctx context.Context, item *appsv3.CatalogItem) (int, string, error) {
+	if item.Spec.RegistryRef == "" {
+		return defaultRegistryID, "", nil
+	}
+
+	registry := &appsv3.Registry{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: item.Spec.RegistryRef, Namespace: item.Namespace}, registry); err != nil {
+		return 0, "RegistryNotFound", err
+	}
+
+	if registry.Status.ID == 0 {
+		return 0, "RegistryNotSynced", fmt.Errorf("%w: %s", errRegistryNotSynced, registry.Name)
+	}
+
+	return int(registry.Status.ID), "", nil
+}
+
+func (r *CatalogItemReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&appsv3.CatalogItem{}).
+		Watches(&source.Kind{Type: &appsv3.Registry{}}, handler.EnqueueRequestsFromMapFunc(r.getRegistryCatalogItems)).
+		Watches(&source.Kind{Type: &cpv3.ControlPlane{}}, handler.EnqueueRequestsFromMapFunc(r.getControlPlaneCatalogItems)).
+		Complete(r)
+}
+
+// getRegistryCatalogItems requeues the CatalogItems pulled from a Registry, so that they follow its ID.
+func (r *CatalogItemReconciler) getRegistryCatalogItems(obj client.Object) []reconcile.Request {
+	items := &appsv3.CatalogItemList{}
+	if err := r.Client.List(context.Background(), items, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "Failed to list catalog items", "Registry.Namespace", obj.GetNamespace(), "Registry.Name", obj.GetName())
+
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+
+	for idx := range items.Items {
+		item := &items.Items[idx]
+		if item.Spec.RegistryRef != obj.GetName() {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: item.Name, Namespace: item.Namespace},
+		})
+	}
+
+	return requests
+}
+
+// getControlPlaneCatalogItems requeues the CatalogItems added to a ControlPlane, so that they resume once it is ready.
+func (r *CatalogItemReconciler) getControlPlaneCatalogItems(obj client.Object) []reconcile.Request {
+	items := &appsv3.CatalogItemList{}
+	if err := r.Client.List(context.Background(), items); err != nil {
+		r.Log.Error(err, "Failed to list catalog items", "ControlPlane.Namespace", obj.GetNamespace(), "ControlPlane.Name", obj.GetName())
+
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+
+	for idx := range items.Items {
+		item := &items.Items[idx]
+		if !iofog.ReferencesControlPlane(item.Namespace, item.Spec.ControlPlaneRef, obj) {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: item.Name, Namespace: item.Namespace},
+		})
+	}
+
+	return requests
+}
+
+// updateStatus writes the status subresource when it differs from original.
+func (r *CatalogItemReconciler) updateStatus(ctx context.Context, item *appsv3.CatalogItem, original *appsv3.CatalogItemStatus) error {
+	if reflect.DeepEqual(original, &item.Status) {
+		return nil
+	}
+
+	if err := r.Status().Update(ctx, item); err != nil {
+		r.Log.Error(err, "Failed to update catalog item status", "CatalogItem.Namespace", item.Namespace, "CatalogItem.Name", item.Name)
+
+		return err
+	}
+
+	return nil
+}
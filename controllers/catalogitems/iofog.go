@@ -0,0 +1,155 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+)
+
+const (
+	agentFogTypeX86 = 1
+	agentFogTypeARM = 2
+	// Docker Hub is the first registry of every ioFog Controller
+	defaultRegistryID = 1
+)
+
+var errInvalidSpec = errors.New("invalid catalog item")
+
+func getCatalogImages(item *appsv3.CatalogItem) ([]iofogclient.CatalogImage, error) {
+	images := []iofogclient.CatalogImage{}
+
+	if item.Spec.Images.X86 != "" {
+		images = append(images, iofogclient.CatalogImage{ContainerImage: item.Spec.Images.X86, AgentTypeID: agentFogTypeX86})
+	}
+
+	if item.Spec.Images.ARM != "" {
+		images = append(images, iofogclient.CatalogImage{ContainerImage: item.Spec.Images.ARM, AgentTypeID: agentFogTypeARM})
+	}
+
+	if len(images) == 0 {
+		return nil, fmt.Errorf("%w: %s has no image", errInvalidSpec, item.Name)
+	}
+
+	return images, nil
+}
+
+// findCatalogItem returns the item with the ID recorded in the status, or the one with the same name.
+func findCatalogItem(clt *iofogclient.Client, item *appsv3.CatalogItem) (*iofogclient.CatalogItemInfo, error) {
+	if item.Status.ID != 0 {
+		info, err := clt.GetCatalogItem(int(item.Status.ID))
+		if err == nil {
+			return info, nil
+		}
+
+		if !iofog.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	response, err := clt.ListCatalogItems()
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range response.CatalogItems {
+		if response.CatalogItems[idx].Name == iofog.GetIofogName(item.Namespace, item.Spec.ControlPlaneRef, item.Name) {
+			return &response.CatalogItems[idx], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func isCatalogItemUpToDate(info *iofogclient.CatalogItemInfo, request *iofogclient.CatalogItemCreateRequest) bool {
+	if info.Description != request.Description || info.Category != request.Category || info.RegistryID != request.RegistryID {
+		return false
+	}
+
+	images := map[int]string{}
+	for _, image := range info.Images {
+		images[image.AgentTypeID] = image.ContainerImage
+	}
+
+	expected := map[int]string{}
+	for _, image := range request.Images {
+		expected[image.AgentTypeID] = image.ContainerImage
+	}
+
+	return reflect.DeepEqual(images, expected)
+}
+
+// syncCatalogItem creates the item in the catalog of the ioFog Controller, or updates it when it differs from the spec.
+func syncCatalogItem(clt *iofogclient.Client, item *appsv3.CatalogItem, registryID int) error {
+	images, err := getCatalogImages(item)
+	if err != nil {
+		return err
+	}
+
+	request := iofogclient.CatalogItemCreateRequest{
+		Name:        iofog.GetIofogName(item.Namespace, item.Spec.ControlPlaneRef, item.Name),
+		Description: item.Spec.Description,
+		Category:    item.Spec.Category,
+		Images:      images,
+		RegistryID:  registryID,
+	}
+
+	info, err := findCatalogItem(clt, item)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info == nil:
+		info, err = clt.CreateCatalogItem(&request)
+	case !isCatalogItemUpToDate(info, &request):
+		info, err = clt.UpdateCatalogItem(&iofogclient.CatalogItemUpdateRequest{
+			ID:          info.ID,
+			Name:        request.Name,
+			Description: request.Description,
+			Category:    request.Category,
+			Images:      request.Images,
+			RegistryID:  request.RegistryID,
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	item.Status.ID = int64(info.ID)
+	item.Status.RegistryID = int64(registryID)
+
+	return nil
+}
+
+func deleteCatalogItem(clt *iofogclient.Client, item *appsv3.CatalogItem) error {
+	if item.Status.ID == 0 {
+		return nil
+	}
+
+	if err := clt.DeleteCatalogItem(int(item.Status.ID)); err != nil && !iofog.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
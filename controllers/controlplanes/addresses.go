@@ -0,0 +1,340 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/controllers/controlplanes/router"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The Port Manager runs the proxy as the http-proxy Deployment
+const proxyName = "http-proxy"
+
+var (
+	errNoNodeAddress       = errors.New("no node address found")
+	errInvalidProxyService = errors.New("invalid proxy Service")
+)
+
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+
+func isNodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// getNodeAddresses prefers the external addresses of a node, which edge devices outside the cluster can reach.
+// Nodes of dual-stack clusters report an address of each family.
+func getNodeAddresses(node *corev1.Node) []string {
+	for _, addressType := range []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeInternalIP} {
+		addresses := []string{}
+
+		for _, address := range node.Status.Addresses {
+			if address.Type == addressType {
+				addresses = append(addresses, address.Address)
+			}
+		}
+
+		if len(addresses) > 0 {
+			return addresses
+		}
+	}
+
+	return nil
+}
+
+func getIPFamily(address string) corev1.IPFamily {
+	ip := net.ParseIP(address)
+
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return corev1.IPv4Protocol
+	default:
+		return corev1.IPv6Protocol
+	}
+}
+
+// sortByIPFamily moves the addresses of the primary family of a Service first, host names are kept last.
+func sortByIPFamily(addresses []string, families []corev1.IPFamily) {
+	rank := func(address string) int {
+		family := getIPFamily(address)
+
+		switch {
+		case family == "":
+			return 2 //nolint:gomnd
+		case len(families) == 0 || family == families[0]:
+			return 0
+		default:
+			return 1
+		}
+	}
+
+	sort.SliceStable(addresses, func(i, j int) bool {
+		return rank(addresses[i]) < rank(addresses[j])
+	})
+}
+
+// getExternalNodeAddresses returns the addresses of the node running a pod matching labels,
+// or of the first ready node when none runs yet. NodePorts are open on every node.
+func (r *reconcileContext) getExternalNodeAddresses(ctx context.Context, labels map[string]string) ([]string, error) {
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods, client.InNamespace(r.cp.Namespace), client.MatchingLabels(labels)); err != nil {
+		return nil, err
+	}
+
+	for idx := range pods.Items {
+		pod := &pods.Items[idx]
+		if pod.Status.Phase != corev1.PodRunning || pod.Spec.NodeName == "" {
+			continue
+		}
+
+		node := &corev1.Node{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, node); err != nil {
+			return nil, err
+		}
+
+		if addresses := getNodeAddresses(node); len(addresses) > 0 {
+			return addresses, nil
+		}
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := r.Client.List(ctx, nodes); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(nodes.Items, func(i, j int) bool {
+		return nodes.Items[i].Name < nodes.Items[j].Name
+	})
+
+	for idx := range nodes.Items {
+		node := &nodes.Items[idx]
+		if !isNodeReady(node) {
+			continue
+		}
+
+		if addresses := getNodeAddresses(node); len(addresses) > 0 {
+			return addresses, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w for pods %v in namespace %s", errNoNodeAddress, labels, r.cp.Namespace)
+}
+
+// getExternalNodeAddress returns the address of the primary family of svc out of getExternalNodeAddresses.
+func (r *reconcileContext) getExternalNodeAddress(ctx context.Context, labels map[string]string, svc *cpv3.Service) (string, error) {
+	addresses, err := r.getExternalNodeAddresses(ctx, labels)
+	if err != nil {
+		return "", err
+	}
+
+	sortByIPFamily(addresses, svc.IPFamilies)
+
+	return addresses[0], nil
+}
+
+// getLoadBalancerAddresses returns the IPs and host names of a LoadBalancer Service, one per family on dual-stack clusters.
+func getLoadBalancerAddresses(svc *corev1.Service) []string {
+	addresses := []string{}
+
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			addresses = append(addresses, ingress.IP)
+		}
+
+		if ingress.Hostname != "" {
+			addresses = append(addresses, ingress.Hostname)
+		}
+	}
+
+	return addresses
+}
+
+// getNodePorts maps the ports of a NodePort Service to the ports allocated on the nodes.
+func (r *reconcileContext) getNodePorts(ctx context.Context, name string) (map[int]int, error) {
+	svc := &corev1.Service{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: r.cp.Namespace}, svc); err != nil {
+		return nil, err
+	}
+
+	ports := make(map[int]int, len(svc.Spec.Ports))
+
+	for _, port := range svc.Spec.Ports {
+		if port.NodePort == 0 {
+			return nil, fmt.Errorf("node port of Service %s port %d is not allocated yet", name, port.Port)
+		}
+
+		ports[int(port.Port)] = int(port.NodePort)
+	}
+
+	return ports, nil
+}
+
+// getRouterIngress returns the address and ports edge devices reach the Router on.
+// Addresses and ports set in the Router ingress take precedence over the ones of the nodes.
+func (r *reconcileContext) getRouterIngress(ctx context.Context) (cpv3.RouterIngress, error) {
+	ingress := r.cp.Spec.Ingresses.Router
+	serviceType := r.cp.Spec.Services.Router.Type
+
+	switch {
+	case strings.EqualFold(serviceType, string(corev1.ServiceTypeLoadBalancer)):
+		k8sClient, err := newK8sClient()
+		if err != nil {
+			return ingress, err
+		}
+
+		//nolint:contextcheck // k8sClient unfortunately does not accept context
+		address, err := k8sClient.WaitForLoadBalancer(r.cp.Namespace, routerName, loadBalancerTimeout)
+		if err != nil {
+			return ingress, err
+		}
+
+		// Dual-stack LoadBalancers have an address of each family
+		svc := &corev1.Service{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: routerName, Namespace: r.cp.Namespace}, svc); err != nil {
+			return ingress, err
+		}
+
+		if addresses := getLoadBalancerAddresses(svc); len(addresses) > 0 {
+			sortByIPFamily(addresses, r.cp.Spec.Services.Router.IPFamilies)
+			address = addresses[0]
+		}
+
+		return cpv3.RouterIngress{
+			Address:      address,
+			MessagePort:  router.MessagePort,
+			InteriorPort: router.InteriorPort,
+			EdgePort:     router.EdgePort,
+		}, nil
+	case strings.EqualFold(serviceType, string(corev1.ServiceTypeNodePort)):
+		ports, err := r.getNodePorts(ctx, routerName)
+		if err != nil {
+			return ingress, err
+		}
+
+		return r.getNodeRouterIngress(ctx, ports[router.MessagePort], ports[router.InteriorPort], ports[router.EdgePort])
+	case isHostNetwork(serviceType):
+		return r.getNodeRouterIngress(ctx, router.MessagePort, router.InteriorPort, router.EdgePort)
+	case ingress.Address != "":
+		return ingress, nil
+	default:
+		return ingress, fmt.Errorf("reconcile Router failed: %s", errProxyRouterMissing)
+	}
+}
+
+func (r *reconcileContext) getNodeRouterIngress(ctx context.Context, messagePort, interiorPort, edgePort int) (cpv3.RouterIngress, error) {
+	ingress := r.cp.Spec.Ingresses.Router
+
+	if ingress.Address == "" {
+		address, err := r.getExternalNodeAddress(ctx, map[string]string{"name": routerName}, &r.cp.Spec.Services.Router)
+		if err != nil {
+			return ingress, err
+		}
+
+		ingress.Address = address
+	}
+
+	if ingress.MessagePort == 0 {
+		ingress.MessagePort = messagePort
+	}
+
+	if ingress.InteriorPort == 0 {
+		ingress.InteriorPort = interiorPort
+	}
+
+	if ingress.EdgePort == 0 {
+		ingress.EdgePort = edgePort
+	}
+
+	return ingress, nil
+}
+
+// validateProxyService rejects the settings of the Service the Port Manager creates for the proxy, which it always exposes
+// through a LoadBalancer of the default IP family of the cluster. The addresses of the proxy otherwise come from spec.ingresses.
+func validateProxyService(svc *cpv3.Service) error {
+	if strings.EqualFold(svc.Type, string(corev1.ServiceTypeNodePort)) || isHostNetwork(svc.Type) {
+		return fmt.Errorf("%w: type %s, the Port Manager only exposes the proxy through a LoadBalancer", errInvalidProxyService, svc.Type)
+	}
+
+	if len(svc.IPFamilies) > 0 || svc.IPFamilyPolicy != nil {
+		return fmt.Errorf("%w: ipFamilies and ipFamilyPolicy only apply to the Controller and Router Services", errInvalidProxyService)
+	}
+
+	return nil
+}
+
+// getRouterHosts lists the addresses and names the Router is reached on, for the SANs of its certificates.
+// address is the one registered with the ioFog Controller, the others cover the other family on dual-stack clusters.
+func (r *reconcileContext) getRouterHosts(ctx context.Context, address string) ([]string, error) {
+	hosts := []string{address}
+
+	svc := &corev1.Service{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: routerName, Namespace: r.cp.Namespace}, svc); err != nil {
+		return nil, err
+	}
+
+	hosts = append(hosts, getLoadBalancerAddresses(svc)...)
+	hosts = append(hosts, svc.Spec.ClusterIPs...)
+
+	serviceType := r.cp.Spec.Services.Router.Type
+	if strings.EqualFold(serviceType, string(corev1.ServiceTypeNodePort)) || isHostNetwork(serviceType) {
+		addresses, err := r.getExternalNodeAddresses(ctx, map[string]string{"name": routerName})
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = append(hosts, addresses...)
+	}
+
+	hosts = append(hosts,
+		routerName,
+		fmt.Sprintf("%s.%s", routerName, r.cp.Namespace),
+		fmt.Sprintf("%s.%s.svc", routerName, r.cp.Namespace),
+		iofog.GetServiceHost(routerName, r.cp.Namespace),
+	)
+
+	unique := []string{}
+	seen := map[string]bool{}
+
+	for _, host := range hosts {
+		if host == "" || host == corev1.ClusterIPNone || seen[host] {
+			continue
+		}
+
+		seen[host] = true
+		unique = append(unique, host)
+	}
+
+	return unique, nil
+}
@@ -0,0 +1,442 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/util"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	backupCronJobName      = "controller-backup"
+	backupVolumeName       = "backup"
+	backupMountPath        = "/backup"
+	backupTargetVolumeName = "backup-target"
+	backupTargetMountPath  = "/target"
+	sqliteDataMountPath    = "/data"
+	s3AccessKeySecretKey   = "access-key-id"
+	s3SecretKeySecretKey   = "secret-access-key" //nolint:gosec
+	dbProviderPostgres     = "postgres"
+	dbProviderMySQL        = "mysql"
+	backupJobBackoffLimit  = 2
+)
+
+// Scripts only reference environment variables so that user input never ends up in a shell command line.
+const (
+	// The online backup API copies a consistent snapshot while the Controller keeps writing
+	sqliteDumpScript = `sqlite3 "$SQLITE_FILE" ".backup /backup/dump"`
+	// Backups of earlier versions are tarballs of the sqlite directory
+	sqliteRestoreScript = `if gzip -t /backup/dump 2>/dev/null; then
+  rm -rf /data/* && tar -xzf /backup/dump -C /data
+else
+  rm -f "$SQLITE_FILE-journal" "$SQLITE_FILE-wal" "$SQLITE_FILE-shm" && sqlite3 "$SQLITE_FILE" ".restore /backup/dump"
+fi`
+	postgresDumpScript    = `pg_dump --clean --if-exists -h "$DB_HOST" -p "$DB_PORT" -U "$DB_USERNAME" -f /backup/dump "$DB_NAME"`
+	postgresRestoreScript = `psql -v ON_ERROR_STOP=1 -h "$DB_HOST" -p "$DB_PORT" -U "$DB_USERNAME" -d "$DB_NAME" -f /backup/dump`
+	mysqlDumpScript       = `mysqldump --single-transaction --routines -h "$DB_HOST" -P "$DB_PORT" -u "$DB_USERNAME" "$DB_NAME" > /backup/dump`
+	mysqlRestoreScript    = `mysql -h "$DB_HOST" -P "$DB_PORT" -u "$DB_USERNAME" "$DB_NAME" < /backup/dump`
+	backupFileName        = `controller-$(date -u +%Y%m%dT%H%M%SZ).$BACKUP_EXTENSION`
+	s3AliasScript         = `mc $S3_FLAGS alias set target "$S3_ENDPOINT" "$S3_ACCESS_KEY" "$S3_SECRET_KEY"`
+	s3UploadScript        = s3AliasScript + ` && mc $S3_FLAGS cp /backup/dump "target/$S3_BUCKET/$S3_PREFIX` + backupFileName + `"`
+	s3DownloadScript      = s3AliasScript + ` && mc $S3_FLAGS cp "target/$S3_BUCKET/$S3_PREFIX$BACKUP_NAME" /backup/dump`
+	pvcUploadScript       = `cp /backup/dump "/target/` + backupFileName + `"`
+	pvcDownloadScript     = `cp "/target/$BACKUP_NAME" /backup/dump`
+)
+
+type backupConfig struct {
+	db              *cpv3.Database
+	backup          *cpv3.Backup
+	target          *cpv3.BackupTarget
+	imagePullSecret string
+}
+
+func validateBackupTarget(target *cpv3.BackupTarget) error {
+	if target.PersistentVolumeClaim != "" && target.IsS3() {
+		return errors.New("backup target must specify either a PersistentVolumeClaim or S3, not both")
+	}
+
+	if target.PersistentVolumeClaim == "" && !target.IsS3() {
+		return errors.New("backup target must specify a PersistentVolumeClaim or S3")
+	}
+
+	if target.IsS3() && (target.S3.Endpoint == "" || target.S3.CredentialsSecret == "") {
+		return errors.New("S3 backup target requires an endpoint and a credentials secret")
+	}
+
+	return nil
+}
+
+func isExternalDB(db *cpv3.Database) bool {
+	return db.Host != ""
+}
+
+func getBackupExtension(db *cpv3.Database) string {
+	if isExternalDB(db) {
+		return "sql"
+	}
+
+	return "sqlite"
+}
+
+func getDumpScript(db *cpv3.Database) (string, error) {
+	if !isExternalDB(db) {
+		return sqliteDumpScript, nil
+	}
+
+	switch db.Provider {
+	case dbProviderPostgres:
+		return postgresDumpScript, nil
+	case dbProviderMySQL:
+		return mysqlDumpScript, nil
+	default:
+		return "", fmt.Errorf("backups are not supported for database provider %s", db.Provider)
+	}
+}
+
+func getRestoreScript(db *cpv3.Database) (string, error) {
+	if !isExternalDB(db) {
+		return sqliteRestoreScript, nil
+	}
+
+	switch db.Provider {
+	case dbProviderPostgres:
+		return postgresRestoreScript, nil
+	case dbProviderMySQL:
+		return mysqlRestoreScript, nil
+	default:
+		return "", fmt.Errorf("restores are not supported for database provider %s", db.Provider)
+	}
+}
+
+func secretKeyEnv(name, secretName, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: secretName,
+				},
+				Key: key,
+			},
+		},
+	}
+}
+
+// getDBEnv reads the credentials of an external database from a secret created by newDBCredentialsSecret.
+func getDBEnv(db *cpv3.Database, secretName string) []corev1.EnvVar {
+	if !isExternalDB(db) {
+		return nil
+	}
+
+	passwordEnv := "PGPASSWORD"
+	if db.Provider == dbProviderMySQL {
+		passwordEnv = "MYSQL_PWD"
+	}
+
+	return []corev1.EnvVar{
+		secretKeyEnv("DB_HOST", secretName, controllerDBHostSecretKey),
+		secretKeyEnv("DB_PORT", secretName, controllerDBPortSecretKey),
+		secretKeyEnv("DB_USERNAME", secretName, controllerDBUserSecretKey),
+		secretKeyEnv("DB_NAME", secretName, controllerDBDBNameSecretKey),
+		secretKeyEnv(passwordEnv, secretName, controllerDBPasswordSecretKey),
+	}
+}
+
+func newSqliteVolume(readOnly bool) corev1.Volume {
+	return corev1.Volume{
+		Name: controllerSqliteVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: controllerSqliteVolumeName,
+				ReadOnly:  readOnly,
+			},
+		},
+	}
+}
+
+func newSqliteVolumeMount(readOnly bool) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      controllerSqliteVolumeName,
+		MountPath: sqliteDataMountPath,
+		SubPath:   controllerSqliteSubPath,
+		ReadOnly:  readOnly,
+	}
+}
+
+func getTargetEnv(target *cpv3.BackupTarget) []corev1.EnvVar {
+	if !target.IsS3() {
+		return nil
+	}
+
+	flags := ""
+	if target.S3.Insecure {
+		flags = "--insecure"
+	}
+
+	return []corev1.EnvVar{
+		{Name: "S3_ENDPOINT", Value: target.S3.Endpoint},
+		{Name: "S3_BUCKET", Value: target.S3.Bucket},
+		{Name: "S3_PREFIX", Value: target.S3.Prefix},
+		{Name: "S3_FLAGS", Value: flags},
+		secretKeyEnv("S3_ACCESS_KEY", target.S3.CredentialsSecret, s3AccessKeySecretKey),
+		secretKeyEnv("S3_SECRET_KEY", target.S3.CredentialsSecret, s3SecretKeySecretKey),
+	}
+}
+
+func (cfg *backupConfig) dumpImage() string {
+	if cfg.backup.DumpImage != "" {
+		return cfg.backup.DumpImage
+	}
+
+	return util.GetBackupDumpImage(cfg.db)
+}
+
+func (cfg *backupConfig) transferImage() string {
+	if cfg.backup.TransferImage != "" {
+		return cfg.backup.TransferImage
+	}
+
+	return util.GetBackupTransferImage(cfg.target.IsS3())
+}
+
+// newBackupPodSpec returns a pod which dumps the database and uploads it to the target,
+// or downloads a backup from the target and restores it when restoreFrom is set.
+func newBackupPodSpec(cfg *backupConfig, restoreFrom string) (*corev1.PodSpec, error) {
+	if err := validateBackupTarget(cfg.target); err != nil {
+		return nil, err
+	}
+
+	dbScript, err := getDumpScript(cfg.db)
+	if restoreFrom != "" {
+		dbScript, err = getRestoreScript(cfg.db)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	transferScript := pvcUploadScript
+	if cfg.target.IsS3() {
+		transferScript = s3UploadScript
+	}
+
+	if restoreFrom != "" {
+		transferScript = pvcDownloadScript
+		if cfg.target.IsS3() {
+			transferScript = s3DownloadScript
+		}
+	}
+
+	backupMount := corev1.VolumeMount{Name: backupVolumeName, MountPath: backupMountPath}
+	volumes := []corev1.Volume{
+		{
+			Name:         backupVolumeName,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		},
+	}
+
+	dbCont := corev1.Container{
+		Name:         "database",
+		Image:        cfg.dumpImage(),
+		Command:      []string{"/bin/sh", "-c", dbScript},
+		Env:          getDBEnv(cfg.db, controllerDBCredentialsSecretName),
+		VolumeMounts: []corev1.VolumeMount{backupMount},
+	}
+
+	transferCont := corev1.Container{
+		Name:    "transfer",
+		Image:   cfg.transferImage(),
+		Command: []string{"/bin/sh", "-c", transferScript},
+		Env: append(getTargetEnv(cfg.target),
+			corev1.EnvVar{Name: "BACKUP_EXTENSION", Value: getBackupExtension(cfg.db)},
+			corev1.EnvVar{Name: "BACKUP_NAME", Value: restoreFrom},
+		),
+		VolumeMounts: []corev1.VolumeMount{backupMount},
+	}
+
+	if !cfg.target.IsS3() {
+		volumes = append(volumes, corev1.Volume{
+			Name: backupTargetVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: cfg.target.PersistentVolumeClaim,
+				},
+			},
+		})
+		transferCont.VolumeMounts = append(transferCont.VolumeMounts, corev1.VolumeMount{
+			Name:      backupTargetVolumeName,
+			MountPath: backupTargetMountPath,
+		})
+	}
+
+	podSpec := &corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+		Volumes:       volumes,
+	}
+
+	if !isExternalDB(cfg.db) {
+		podSpec.Volumes = append(podSpec.Volumes, newSqliteVolume(restoreFrom == ""))
+		dbCont.VolumeMounts = append(dbCont.VolumeMounts, newSqliteVolumeMount(restoreFrom == ""))
+		dbCont.Env = append(dbCont.Env, corev1.EnvVar{Name: "SQLITE_FILE", Value: sqliteDatabaseFile})
+
+		// The sqlite claim is usually ReadWriteOnce, so backups must run next to the Controller
+		if restoreFrom == "" {
+			podSpec.Affinity = &corev1.Affinity{
+				PodAffinity: &corev1.PodAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+						{
+							LabelSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{"name": controllerName},
+							},
+							TopologyKey: "kubernetes.io/hostname",
+						},
+					},
+				},
+			}
+		}
+	}
+
+	// Init containers run to completion before the main container starts
+	if restoreFrom == "" {
+		podSpec.InitContainers = []corev1.Container{dbCont}
+		podSpec.Containers = []corev1.Container{transferCont}
+	} else {
+		podSpec.InitContainers = []corev1.Container{transferCont}
+		podSpec.Containers = []corev1.Container{dbCont}
+	}
+
+	if cfg.imagePullSecret != "" {
+		podSpec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: cfg.imagePullSecret}}
+	}
+
+	return podSpec, nil
+}
+
+func newBackupCronJob(namespace string, cfg *backupConfig) (*batchv1.CronJob, error) {
+	podSpec, err := newBackupPodSpec(cfg, "")
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		"name": backupCronJobName,
+	}
+	backoffLimit := int32(backupJobBackoffLimit)
+
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backupCronJobName,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   cfg.backup.Schedule,
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: cfg.backup.SuccessfulJobsHistoryLimit,
+			FailedJobsHistoryLimit:     cfg.backup.FailedJobsHistoryLimit,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: labels,
+						},
+						Spec: *podSpec,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func newRestoreJob(namespace, name, backup string, cfg *backupConfig) (*batchv1.Job, error) {
+	podSpec, err := newBackupPodSpec(cfg, backup)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		"name": "controller-restore",
+	}
+	backoffLimit := int32(backupJobBackoffLimit)
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: *podSpec,
+			},
+		},
+	}, nil
+}
+
+// getJobResult reports whether a Job has finished, with an error if it failed.
+func getJobResult(job *batchv1.Job) (finished bool, err error) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			return true, fmt.Errorf("job %s failed: %s", job.Name, condition.Message)
+		case batchv1.JobSuspended, batchv1.JobFailureTarget:
+		}
+	}
+
+	return false, nil
+}
+
+// scaleDeployment sets the replicas of a Deployment and reports whether all pods reached that count.
+func scaleDeployment(ctx context.Context, c client.Client, namespace, name string, replicas int32) (bool, error) {
+	dep := &appsv1.Deployment{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, dep); err != nil {
+		return false, err
+	}
+
+	if dep.Spec.Replicas == nil || *dep.Spec.Replicas != replicas {
+		patch := client.MergeFrom(dep.DeepCopy())
+		dep.Spec.Replicas = &replicas
+
+		return false, c.Patch(ctx, dep, patch)
+	}
+
+	return dep.Status.Replicas == replicas, nil
+}
@@ -33,19 +33,36 @@ import (
 type ControlPlaneReconciler struct {
 	client.Client
 	Log    logr.Logger
-	log    logr.Logger
 	Scheme *runtime.Scheme
-	cp     cpv3.ControlPlane
+}
+
+// reconcileContext holds the state of a single reconciliation of a ControlPlane.
+// Each request gets its own, so that several ControlPlanes can be reconciled concurrently.
+type reconcileContext struct {
+	*ControlPlaneReconciler
+	log logr.Logger
+	cp  *cpv3.ControlPlane
+	// controllerCA is the only CA the ioFog clients trust when the Controller serves TLS
+	controllerCA []byte
 }
 
 // +kubebuilder:rbac:groups=iofog.org,resources=controlplanes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=iofog.org,resources=controlplanes/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=batch,resources=cronjobs;jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes;tcproutes,verbs=get;list;watch;create;update;patch;delete
 
 func (r *ControlPlaneReconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
-	r.log = r.Log.WithValues("controlplane", request.NamespacedName)
+	rc := &reconcileContext{
+		ControlPlaneReconciler: r,
+		log:                    r.Log.WithValues("controlplane", request.NamespacedName),
+		cp:                     &cpv3.ControlPlane{},
+	}
 
 	// Fetch the ControlPlane control plane
-	if err := r.Client.Get(ctx, request.NamespacedName, &r.cp); err != nil {
+	if err := r.Client.Get(ctx, request.NamespacedName, rc.cp); err != nil {
 		if k8serrors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
@@ -56,8 +73,15 @@ func (r *ControlPlaneReconciler) Reconcile(ctx context.Context, request ctrl.Req
 		return op.RequeueWithError(err)
 	}
 
+	// Hand restore requests over to the ControlPlaneRestore reconciler
+	if backup, found := rc.cp.Annotations[cpv3.RestoreFromAnnotation]; found {
+		if err := rc.createRestoreFromAnnotation(ctx, backup); err != nil {
+			return op.RequeueWithError(err)
+		}
+	}
+
 	// Reconcile based on state
-	reconciler, err := r.getReconcileFunc(ctx)
+	reconciler, err := rc.getReconcileFunc(ctx)
 	if err != nil {
 		return op.RequeueWithError(err)
 	}
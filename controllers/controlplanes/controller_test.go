@@ -0,0 +1,138 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/testutil"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testRounds = 3
+
+func newTestReconciler(t *testing.T) *ControlPlaneReconciler {
+	t.Helper()
+
+	scheme := testutil.NewScheme(t)
+	objs := []client.Object{}
+
+	for idx := 0; idx < testutil.ControlPlanes; idx++ {
+		namespace := testutil.GetNamespace(idx)
+		objs = append(objs, &cpv3.ControlPlane{
+			ObjectMeta: metav1.ObjectMeta{Name: "iofog", Namespace: namespace},
+			Spec: cpv3.ControlPlaneSpec{
+				User: cpv3.User{Email: "user@" + namespace, Password: namespace},
+				Services: cpv3.Services{
+					Router: cpv3.Service{Type: string(corev1.ServiceTypeClusterIP)},
+				},
+				Ingresses: cpv3.Ingresses{
+					Router: cpv3.RouterIngress{Address: "router." + namespace + ".example.com"},
+				},
+			},
+		})
+	}
+
+	return &ControlPlaneReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		Log:    logr.Discard(),
+		Scheme: scheme,
+	}
+}
+
+// TestReconcileControlPlanesConcurrently reconciles several ControlPlanes in parallel, as the manager does with
+// MaxConcurrentReconciles above one, and checks that each reconciliation only deploys and reports its own ControlPlane.
+// Run with -race to catch state shared between reconciliations.
+func TestReconcileControlPlanesConcurrently(t *testing.T) {
+	reconciler := newTestReconciler(t)
+	ctx := context.Background()
+
+	for round := 0; round < testRounds; round++ {
+		var wg sync.WaitGroup
+
+		for idx := 0; idx < testutil.ControlPlanes; idx++ {
+			request := ctrl.Request{NamespacedName: types.NamespacedName{Name: "iofog", Namespace: testutil.GetNamespace(idx)}}
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if _, err := reconciler.Reconcile(ctx, request); err != nil {
+					t.Errorf("reconcile %s: %v", request.NamespacedName, err)
+				}
+			}()
+		}
+
+		wg.Wait()
+	}
+
+	for idx := 0; idx < testutil.ControlPlanes; idx++ {
+		if err := checkReconciledControlPlane(ctx, reconciler.Client, testutil.GetNamespace(idx)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// checkReconciledControlPlane checks that the Router of the ControlPlane in namespace is deployed with its own address,
+// and that the ControlPlane waits for it before deploying the Controller.
+func checkReconciledControlPlane(ctx context.Context, c client.Client, namespace string) error {
+	dep := &appsv1.Deployment{}
+	if err := c.Get(ctx, types.NamespacedName{Name: routerName, Namespace: namespace}, dep); err != nil {
+		return fmt.Errorf("router Deployment of namespace %s: %w", namespace, err)
+	}
+
+	if dep.Namespace != namespace || len(dep.OwnerReferences) != 1 || dep.OwnerReferences[0].Name != "iofog" {
+		return fmt.Errorf("router Deployment of namespace %s is not owned by its ControlPlane", namespace)
+	}
+
+	cp := &cpv3.ControlPlane{}
+	if err := c.Get(ctx, types.NamespacedName{Name: "iofog", Namespace: namespace}, cp); err != nil {
+		return err
+	}
+
+	phases := map[string]string{}
+	for _, component := range cp.Status.Components {
+		phases[component.Name] = component.Phase
+	}
+
+	if len(phases) != len(cp.Status.Components) || phases[routerName] != cpv3.ComponentPhaseWaiting || phases[controllerName] != cpv3.ComponentPhasePending {
+		return fmt.Errorf("ControlPlane of namespace %s reports components %v", namespace, cp.Status.Components)
+	}
+
+	deps := &appsv1.DeploymentList{}
+	if err := c.List(ctx, deps, client.InNamespace(namespace)); err != nil {
+		return err
+	}
+
+	if len(deps.Items) != 1 {
+		return fmt.Errorf("namespace %s has %d Deployments, want only the Router", namespace, len(deps.Items))
+	}
+
+	return nil
+}
@@ -4,20 +4,25 @@ import (
 	"context"
 	b64 "encoding/base64"
 	"fmt"
+	"reflect"
 	"strings"
 
 	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
 	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-func (r *ControlPlaneReconciler) deploymentExists(ctx context.Context, namespace, name string) (bool, error) {
+func (r *reconcileContext) deploymentExists(ctx context.Context, namespace, name string) (bool, error) {
 	key := types.NamespacedName{
 		Name:      name,
 		Namespace: namespace,
@@ -36,7 +41,7 @@ func (r *ControlPlaneReconciler) deploymentExists(ctx context.Context, namespace
 	return false, err
 }
 
-func (r *ControlPlaneReconciler) restartPodsForDeployment(ctx context.Context, deploymentName, namespace string) error {
+func (r *reconcileContext) restartPodsForDeployment(ctx context.Context, deploymentName, namespace string) error {
 	// Check if this resource already exists
 	found := &appsv1.Deployment{}
 	if err := r.Client.Get(ctx, types.NamespacedName{Name: deploymentName, Namespace: namespace}, found); err != nil {
@@ -62,10 +67,10 @@ func (r *ControlPlaneReconciler) restartPodsForDeployment(ctx context.Context, d
 	return r.Client.Update(ctx, found)
 }
 
-func (r *ControlPlaneReconciler) createDeployment(ctx context.Context, ms *microservice) error {
+func (r *reconcileContext) createDeployment(ctx context.Context, ms *microservice) error {
 	dep := newDeployment(r.cp.ObjectMeta.Namespace, ms)
 	// Set ControlPlane instance as the owner and controller
-	if err := controllerutil.SetControllerReference(&r.cp, dep, r.Scheme); err != nil {
+	if err := controllerutil.SetControllerReference(r.cp, dep, r.Scheme); err != nil {
 		return err
 	}
 
@@ -90,6 +95,11 @@ func (r *ControlPlaneReconciler) createDeployment(ctx context.Context, ms *micro
 	// Resource already exists - update it
 	r.log.Info("Updating existing Deployment", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
 
+	// The HorizontalPodAutoscaler owns the replica count
+	if ms.autoscaling != nil && found.Spec.Replicas != nil {
+		dep.Spec.Replicas = found.Spec.Replicas
+	}
+
 	if err := r.Client.Update(ctx, dep); err != nil {
 		return err
 	}
@@ -97,34 +107,108 @@ func (r *ControlPlaneReconciler) createDeployment(ctx context.Context, ms *micro
 	return nil
 }
 
-func (r *ControlPlaneReconciler) createPersistentVolumeClaims(ctx context.Context, ms *microservice) error {
-	for i := range ms.volumes {
-		if ms.volumes[i].VolumeSource.PersistentVolumeClaim == nil {
-			continue
-		}
+func (r *reconcileContext) createHorizontalPodAutoscaler(ctx context.Context, hpa *autoscalingv2.HorizontalPodAutoscaler) error {
+	// Set ControlPlane instance as the owner and controller
+	if err := controllerutil.SetControllerReference(r.cp, hpa, r.Scheme); err != nil {
+		return err
+	}
 
-		storageSize, err := resource.ParseQuantity("1Gi")
-		if err != nil {
-			return err
-		}
+	// Check if this resource already exists
+	found := &autoscalingv2.HorizontalPodAutoscaler{}
 
-		pvc := corev1.PersistentVolumeClaim{
-			Spec: corev1.PersistentVolumeClaimSpec{
-				AccessModes: []corev1.PersistentVolumeAccessMode{
-					corev1.ReadWriteOnce,
-				},
-				Resources: corev1.ResourceRequirements{
-					Requests: corev1.ResourceList{
-						"storage": storageSize,
-					},
-				},
-			},
-		}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: hpa.Name, Namespace: hpa.Namespace}, found)
+	if err != nil && k8serrors.IsNotFound(err) {
+		r.log.Info("Creating a new HorizontalPodAutoscaler", "HorizontalPodAutoscaler.Namespace", hpa.Namespace, "HorizontalPodAutoscaler.Name", hpa.Name)
+
+		return r.Client.Create(ctx, hpa)
+	} else if err != nil {
+		return err
+	}
+
+	// Resource already exists - update it
+	hpa.ResourceVersion = found.ResourceVersion
+
+	return r.Client.Update(ctx, hpa)
+}
+
+func (r *reconcileContext) createPodDisruptionBudget(ctx context.Context, pdb *policyv1.PodDisruptionBudget) error {
+	// Set ControlPlane instance as the owner and controller
+	if err := controllerutil.SetControllerReference(r.cp, pdb, r.Scheme); err != nil {
+		return err
+	}
+
+	// Check if this resource already exists
+	found := &policyv1.PodDisruptionBudget{}
+
+	err := r.Client.Get(ctx, types.NamespacedName{Name: pdb.Name, Namespace: pdb.Namespace}, found)
+	if err != nil && k8serrors.IsNotFound(err) {
+		r.log.Info("Creating a new PodDisruptionBudget", "PodDisruptionBudget.Namespace", pdb.Namespace, "PodDisruptionBudget.Name", pdb.Name)
+
+		return r.Client.Create(ctx, pdb)
+	} else if err != nil {
+		return err
+	}
+
+	// Resource already exists - update it
+	pdb.ResourceVersion = found.ResourceVersion
+
+	return r.Client.Update(ctx, pdb)
+}
 
-		pvc.ObjectMeta.Name = ms.volumes[i].Name
-		pvc.ObjectMeta.Namespace = r.cp.Namespace
+func (r *reconcileContext) deleteResource(ctx context.Context, obj client.Object) error {
+	return client.IgnoreNotFound(r.Client.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)))
+}
+
+func (r *reconcileContext) createCronJob(ctx context.Context, cronJob *batchv1.CronJob) error {
+	// Set ControlPlane instance as the owner and controller
+	if err := controllerutil.SetControllerReference(r.cp, cronJob, r.Scheme); err != nil {
+		return err
+	}
+
+	// Check if this resource already exists
+	found := &batchv1.CronJob{}
+
+	err := r.Client.Get(ctx, types.NamespacedName{Name: cronJob.Name, Namespace: cronJob.Namespace}, found)
+	if err != nil && k8serrors.IsNotFound(err) {
+		r.log.Info("Creating a new CronJob", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+
+		return r.Client.Create(ctx, cronJob)
+	} else if err != nil {
+		return err
+	}
+
+	// Resource already exists - update it
+	r.log.Info("Updating existing CronJob", "CronJob.Namespace", found.Namespace, "CronJob.Name", found.Name)
+
+	cronJob.ResourceVersion = found.ResourceVersion
+
+	return r.Client.Update(ctx, cronJob)
+}
+
+func (r *reconcileContext) deleteCronJob(ctx context.Context, name string) error {
+	found := &batchv1.CronJob{}
+
+	err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: r.cp.Namespace}, found)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	r.log.Info("Deleting CronJob", "CronJob.Namespace", found.Namespace, "CronJob.Name", found.Name)
+
+	return client.IgnoreNotFound(r.Client.Delete(ctx, found, client.PropagationPolicy(metav1.DeletePropagationBackground)))
+}
+
+func (r *reconcileContext) createPersistentVolumeClaims(ctx context.Context, ms *microservice) error {
+	pvcs, err := newPersistentVolumeClaims(r.cp.Namespace, ms)
+	if err != nil {
+		return err
+	}
+
+	for _, pvc := range pvcs {
 		// Set ControlPlane instance as the owner and controller
-		if err := controllerutil.SetControllerReference(&r.cp, &pvc, r.Scheme); err != nil {
+		if err := controllerutil.SetControllerReference(r.cp, pvc, r.Scheme); err != nil {
 			return err
 		}
 
@@ -135,7 +219,7 @@ func (r *ControlPlaneReconciler) createPersistentVolumeClaims(ctx context.Contex
 		if err != nil && k8serrors.IsNotFound(err) {
 			r.log.Info("Creating a new PersistentVolumeClaim", "PersistentVolumeClaim.Namespace", pvc.Namespace, "PersistentVolumeClaim.Name", pvc.Name)
 
-			err = r.Client.Create(ctx, &pvc)
+			err = r.Client.Create(ctx, pvc)
 			if err != nil {
 				return err
 			}
@@ -146,18 +230,105 @@ func (r *ControlPlaneReconciler) createPersistentVolumeClaims(ctx context.Contex
 			return err
 		}
 
-		// Resource already exists - don't requeue
-		r.log.Info("Skip reconcile: Secret already exists", "Secret.Namespace", found.Namespace, "Secret.Name", found.Name)
+		// Resource already exists - patch the mutable fields
+		if err := r.updatePersistentVolumeClaim(ctx, found, pvc); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (r *ControlPlaneReconciler) createSecrets(ctx context.Context, ms *microservice) error {
+// updatePersistentVolumeClaim expands the claim and merges its annotations.
+// Storage class and access modes are immutable once the claim is bound, and claims cannot shrink.
+func (r *reconcileContext) updatePersistentVolumeClaim(ctx context.Context, found, pvc *corev1.PersistentVolumeClaim) error {
+	patch := client.MergeFrom(found.DeepCopy())
+	changed := false
+
+	desiredSize := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	currentSize := found.Spec.Resources.Requests[corev1.ResourceStorage]
+
+	switch desiredSize.Cmp(currentSize) {
+	case 1:
+		r.log.Info("Expanding PersistentVolumeClaim", "PersistentVolumeClaim.Name", found.Name, "from", currentSize.String(), "to", desiredSize.String())
+
+		if found.Spec.Resources.Requests == nil {
+			found.Spec.Resources.Requests = corev1.ResourceList{}
+		}
+
+		found.Spec.Resources.Requests[corev1.ResourceStorage] = desiredSize
+		changed = true
+	case -1:
+		r.log.Info("Skip shrinking PersistentVolumeClaim", "PersistentVolumeClaim.Name", found.Name, "from", currentSize.String(), "to", desiredSize.String())
+	}
+
+	for key, val := range pvc.Annotations {
+		if found.Annotations[key] == val {
+			continue
+		}
+
+		if found.Annotations == nil {
+			found.Annotations = map[string]string{}
+		}
+
+		found.Annotations[key] = val
+		changed = true
+	}
+
+	if pvc.Spec.StorageClassName != nil && (found.Spec.StorageClassName == nil || *found.Spec.StorageClassName != *pvc.Spec.StorageClassName) {
+		r.log.Info("Skip updating immutable storage class of PersistentVolumeClaim", "PersistentVolumeClaim.Name", found.Name)
+	}
+
+	if !reflect.DeepEqual(found.Spec.AccessModes, pvc.Spec.AccessModes) {
+		r.log.Info("Skip updating immutable access modes of PersistentVolumeClaim", "PersistentVolumeClaim.Name", found.Name)
+	}
+
+	if !changed {
+		r.log.Info("Skip reconcile: PersistentVolumeClaim already exists", "PersistentVolumeClaim.Namespace", found.Namespace, "PersistentVolumeClaim.Name", found.Name)
+
+		return nil
+	}
+
+	return r.Client.Patch(ctx, found, patch)
+}
+
+// updateStorageStatus records the phase and capacity of the sqlite claim.
+// It reports whether the status changed and whether an expansion is still pending.
+func (r *reconcileContext) updateStorageStatus(ctx context.Context) (changed, resizing bool, err error) {
+	status := cpv3.StorageStatus{}
+
+	found := &corev1.PersistentVolumeClaim{}
+
+	err = r.Client.Get(ctx, types.NamespacedName{Name: controllerSqliteVolumeName, Namespace: r.cp.Namespace}, found)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return false, false, err
+	}
+
+	if err == nil {
+		status.Phase = string(found.Status.Phase)
+
+		if capacity, ok := found.Status.Capacity[corev1.ResourceStorage]; ok {
+			status.Capacity = capacity.String()
+
+			request := found.Spec.Resources.Requests[corev1.ResourceStorage]
+			resizing = capacity.Cmp(request) < 0
+		}
+	}
+
+	if status == r.cp.Status.Storage {
+		return false, resizing, nil
+	}
+
+	r.cp.Status.Storage = status
+
+	return true, resizing, nil
+}
+
+func (r *reconcileContext) createSecrets(ctx context.Context, ms *microservice) error {
 	return r.createOrUpdateSecrets(ctx, ms, false)
 }
 
-func (r *ControlPlaneReconciler) createOrUpdateSecrets(ctx context.Context, ms *microservice, update bool) error {
+func (r *reconcileContext) createOrUpdateSecrets(ctx context.Context, ms *microservice, update bool) error {
 	defer func() {
 		if recoverResult := recover(); recoverResult != nil {
 			r.log.Info(fmt.Sprintf("Recover result %v for creating secrets for Controlplane %s", recoverResult, r.cp.Name))
@@ -170,7 +341,7 @@ func (r *ControlPlaneReconciler) createOrUpdateSecrets(ctx context.Context, ms *
 		// Set ControlPlane instance as the owner and controller
 		r.log.Info(fmt.Sprintf("Setting owner reference for secret %s", secret.ObjectMeta.Name))
 
-		if err := controllerutil.SetControllerReference(&r.cp, secret, r.Scheme); err != nil {
+		if err := controllerutil.SetControllerReference(r.cp, secret, r.Scheme); err != nil {
 			r.log.Info(fmt.Sprintf("Failed to set owner reference for secret %s: %v", secret.ObjectMeta.Name, err))
 
 			return err
@@ -218,11 +389,11 @@ func (r *ControlPlaneReconciler) createOrUpdateSecrets(ctx context.Context, ms *
 	return nil
 }
 
-func (r *ControlPlaneReconciler) createService(ctx context.Context, ms *microservice) error {
+func (r *reconcileContext) createService(ctx context.Context, ms *microservice) error {
 	svcs := newServices(r.cp.ObjectMeta.Namespace, ms)
 	for _, svc := range svcs {
 		// Set ControlPlane instance as the owner and controller
-		if err := controllerutil.SetControllerReference(&r.cp, svc, r.Scheme); err != nil {
+		if err := controllerutil.SetControllerReference(r.cp, svc, r.Scheme); err != nil {
 			return err
 		}
 
@@ -244,14 +415,57 @@ func (r *ControlPlaneReconciler) createService(ctx context.Context, ms *microser
 			return err
 		}
 
-		// Resource already exists - don't requeue
-		r.log.Info("Skip reconcile: Service already exists", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+		// Changing the type of a Service also changes its node ports and load balancer, so it is recreated
+		if svc.Spec.Type != "" && found.Spec.Type != svc.Spec.Type {
+			r.log.Info("Recreating Service with type "+string(svc.Spec.Type), "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+
+			if err := r.Client.Delete(ctx, found); err != nil && !k8serrors.IsNotFound(err) {
+				return err
+			}
+
+			if err := r.Client.Create(ctx, svc); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// Resource already exists - only the type and the application protocols of its ports follow the ControlPlane
+		if !setAppProtocols(found, svc) {
+			r.log.Info("Skip reconcile: Service already exists", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+
+			continue
+		}
+
+		r.log.Info("Updating application protocols of Service", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+
+		if err := r.Client.Update(ctx, found); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (r *ControlPlaneReconciler) createServiceAccount(ctx context.Context, ms *microservice) error {
+// setAppProtocols copies the application protocols of the ports of svc to the matching ports of found, and reports whether any changed.
+func setAppProtocols(found, svc *corev1.Service) (changed bool) {
+	for i := range found.Spec.Ports {
+		for j := range svc.Spec.Ports {
+			if found.Spec.Ports[i].Port != svc.Spec.Ports[j].Port {
+				continue
+			}
+
+			if !reflect.DeepEqual(found.Spec.Ports[i].AppProtocol, svc.Spec.Ports[j].AppProtocol) {
+				found.Spec.Ports[i].AppProtocol = svc.Spec.Ports[j].AppProtocol
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+func (r *reconcileContext) createServiceAccount(ctx context.Context, ms *microservice) error {
 	svcAcc := newServiceAccount(r.cp.ObjectMeta.Namespace, ms)
 
 	// Set image pull secret for the service account
@@ -277,7 +491,7 @@ func (r *ControlPlaneReconciler) createServiceAccount(ctx context.Context, ms *m
 	}
 
 	// Set ControlPlane instance as the owner and controller
-	if err := controllerutil.SetControllerReference(&r.cp, svcAcc, r.Scheme); err != nil {
+	if err := controllerutil.SetControllerReference(r.cp, svcAcc, r.Scheme); err != nil {
 		return err
 	}
 
@@ -304,11 +518,11 @@ func (r *ControlPlaneReconciler) createServiceAccount(ctx context.Context, ms *m
 	return nil
 }
 
-func (r *ControlPlaneReconciler) createRole(ctx context.Context, ms *microservice) error { //nolint:dupl
+func (r *reconcileContext) createRole(ctx context.Context, ms *microservice) error {
 	role := newRole(r.cp.ObjectMeta.Namespace, ms)
 
 	// Set ControlPlane instance as the owner and controller
-	if err := controllerutil.SetControllerReference(&r.cp, role, r.Scheme); err != nil {
+	if err := controllerutil.SetControllerReference(r.cp, role, r.Scheme); err != nil {
 		return err
 	}
 
@@ -330,17 +544,25 @@ func (r *ControlPlaneReconciler) createRole(ctx context.Context, ms *microservic
 		return err
 	}
 
-	// Resource already exists - don't requeue
-	r.log.Info("Skip reconcile: Role already exists", "Role.Namespace", found.Namespace, "Role.Name", found.Name)
+	if reflect.DeepEqual(found.Rules, role.Rules) {
+		r.log.Info("Skip reconcile: Role already exists", "Role.Namespace", found.Namespace, "Role.Name", found.Name)
 
-	return nil
+		return nil
+	}
+
+	// Rules change with the configuration and version of the component
+	r.log.Info("Updating Role rules", "Role.Namespace", found.Namespace, "Role.Name", found.Name)
+
+	found.Rules = role.Rules
+
+	return r.Client.Update(ctx, found)
 }
 
-func (r *ControlPlaneReconciler) createRoleBinding(ctx context.Context, ms *microservice) error { //nolint:dupl
+func (r *reconcileContext) createRoleBinding(ctx context.Context, ms *microservice) error { //nolint:dupl
 	crb := newRoleBinding(r.cp.ObjectMeta.Namespace, ms)
 
 	// Set ControlPlane instance as the owner and controller
-	if err := controllerutil.SetControllerReference(&r.cp, crb, r.Scheme); err != nil {
+	if err := controllerutil.SetControllerReference(r.cp, crb, r.Scheme); err != nil {
 		return err
 	}
 
@@ -368,7 +590,7 @@ func (r *ControlPlaneReconciler) createRoleBinding(ctx context.Context, ms *micr
 	return nil
 }
 
-func (r *ControlPlaneReconciler) createIofogUser(iofogClient *iofogclient.Client) error {
+func (r *reconcileContext) createIofogUser(iofogClient *iofogclient.Client) error {
 	user := iofogclient.User{
 		Name:     r.cp.Spec.User.Name,
 		Surname:  r.cp.Spec.User.Surname,
@@ -399,7 +621,7 @@ func (r *ControlPlaneReconciler) createIofogUser(iofogClient *iofogclient.Client
 	return nil
 }
 
-func (r *ControlPlaneReconciler) updateIofogUser(iofogClient *iofogclient.Client, oldPassword, newPassword string) error {
+func (r *reconcileContext) updateIofogUser(iofogClient *iofogclient.Client, oldPassword, newPassword string) error {
 	// Update password
 	if newPassword != "" && newPassword != oldPassword {
 		if err := iofogClient.UpdateUserPassword(iofogclient.UpdateUserPasswordRequest{
@@ -425,7 +647,7 @@ func newInt(val int) *int {
 	return &val
 }
 
-func (r *ControlPlaneReconciler) createDefaultRouter(iofogClient *iofogclient.Client, proxy cpv3.RouterIngress) (err error) {
+func (r *reconcileContext) createDefaultRouter(iofogClient *iofogclient.Client, proxy cpv3.RouterIngress) (err error) {
 	routerConfig := iofogclient.Router{
 		Host: proxy.Address,
 		RouterConfig: iofogclient.RouterConfig{
@@ -0,0 +1,69 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/testutil"
+	"github.com/go-logr/logr"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TestCreateRoleUpdatesRules checks that the Role of the Port Manager follows its rules when an older operator
+// created it with different ones.
+func TestCreateRoleUpdatesRules(t *testing.T) {
+	reconciler := newTestReconciler(t)
+	ctx := context.Background()
+	namespace := testutil.GetNamespace(0)
+
+	cp := &cpv3.ControlPlane{}
+	if err := reconciler.Client.Get(ctx, types.NamespacedName{Name: "iofog", Namespace: namespace}, cp); err != nil {
+		t.Fatal(err)
+	}
+
+	ms := newPortManagerMicroservice(&portManagerConfig{watchNamespace: namespace})
+
+	stale := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{Name: ms.name, Namespace: namespace},
+		Rules: []rbacv1.PolicyRule{
+			{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}},
+		},
+	}
+	if err := reconciler.Client.Create(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	rc := &reconcileContext{ControlPlaneReconciler: reconciler, log: logr.Discard(), cp: cp}
+	if err := rc.createRole(ctx, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	role := &rbacv1.Role{}
+	if err := reconciler.Client.Get(ctx, types.NamespacedName{Name: ms.name, Namespace: namespace}, role); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(role.Rules, ms.rbacRules) {
+		t.Errorf("Role has rules %v, want %v", role.Rules, ms.rbacRules)
+	}
+}
@@ -15,14 +15,18 @@ package controllers
 
 import (
 	"errors"
+	"path"
 	"strconv"
 	"strings"
 
 	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
 	"github.com/eclipse-iofog/iofog-operator/v3/controllers/controlplanes/router"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
 	"github.com/eclipse-iofog/iofog-operator/v3/internal/util"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
@@ -41,6 +45,17 @@ const (
 	controllerDBPortSecretKey         = "port"
 	controllerS2STokensSecretName     = "controller-s2s-tokens" //nolint:gosec
 	proxyBrokerTokenSecretKey         = "proxy-broker-token"    //nolint:gosec
+	controllerSqliteVolumeName        = "controller-sqlite"
+	// Existing claims hold the sqlite files under this sub directory, so it must not change
+	controllerSqliteSubPath   = "prod_database.sqlite"
+	controllerSqliteMountPath = "/usr/local/lib/node_modules/@iofog/iofogcontroller/src/data/sqlite_files/"
+	controllerTLSVolumeName   = "controller-tls"
+	controllerTLSMountPath    = "/etc/iofog-controller/tls"
+	defaultStorageSize        = "1Gi"
+	defaultTargetCPU          = 80
+	defaultCPURequest         = "400m"
+	// Changes of the certificate of the Controller roll its pods, which only load it on start
+	tlsChecksumAnnotation = "iofog.org/tls-checksum"
 )
 
 type service struct {
@@ -49,6 +64,9 @@ type service struct {
 	trafficPolicy    string
 	serviceType      string
 	ports            []int
+	ipFamilies       []corev1.IPFamily
+	ipFamilyPolicy   *corev1.IPFamilyPolicy
+	appProtocols     map[int]string
 }
 
 type microservice struct {
@@ -64,6 +82,24 @@ type microservice struct {
 	rbacRules             []rbacv1.PolicyRule
 	mustRecreateOnRollout bool
 	availableDelay        int32
+	storage               storage
+	autoscaling           *autoscaling
+	spreadReplicas        bool
+	hostNetwork           bool
+}
+
+type autoscaling struct {
+	minReplicas    int32
+	maxReplicas    int32
+	metrics        []autoscalingv2.MetricSpec
+	maxUnavailable intstr.IntOrString
+}
+
+type storage struct {
+	size             string
+	storageClassName string
+	accessModes      []string
+	annotations      map[string]string
 }
 
 type container struct {
@@ -85,6 +121,8 @@ type controllerMicroserviceConfig struct {
 	imagePullSecret   string
 	serviceType       string
 	loadBalancerAddr  string
+	ipFamilies        []corev1.IPFamily
+	ipFamilyPolicy    *corev1.IPFamilyPolicy
 	db                *cpv3.Database
 	proxyImage        string
 	routerImage       string
@@ -97,6 +135,9 @@ type controllerMicroserviceConfig struct {
 	proxyBrokerURL    string
 	proxyBrokerToken  string
 	portRouterImage   string
+	storage           cpv3.Storage
+	resources         corev1.ResourceRequirements
+	autoscaling       *cpv3.HorizontalAutoscaling
 }
 
 func filterControllerConfig(cfg *controllerMicroserviceConfig) {
@@ -119,6 +160,75 @@ func filterControllerConfig(cfg *controllerMicroserviceConfig) {
 	if cfg.pidBaseDir == "" {
 		cfg.pidBaseDir = "/tmp"
 	}
+
+	if cfg.storage.Size == "" {
+		cfg.storage.Size = defaultStorageSize
+	}
+
+	if len(cfg.storage.AccessModes) == 0 {
+		cfg.storage.AccessModes = []string{string(corev1.ReadWriteOnce)}
+	}
+
+	// Every replica of the Controller would open its own sqlite database
+	if cfg.db.Host == "" {
+		cfg.autoscaling = nil
+	}
+}
+
+func newAutoscaling(cfg *cpv3.HorizontalAutoscaling) *autoscaling {
+	scaling := &autoscaling{
+		minReplicas:    cfg.MinReplicas,
+		maxReplicas:    cfg.MaxReplicas,
+		metrics:        cfg.Metrics,
+		maxUnavailable: intstr.FromInt(1),
+	}
+
+	if scaling.minReplicas == 0 {
+		scaling.minReplicas = 1
+	}
+
+	if scaling.maxReplicas < scaling.minReplicas {
+		scaling.maxReplicas = scaling.minReplicas
+	}
+
+	if cfg.MaxUnavailable != nil {
+		scaling.maxUnavailable = *cfg.MaxUnavailable
+	}
+
+	if len(scaling.metrics) == 0 {
+		target := cfg.TargetCPUUtilizationPercentage
+		if target == 0 {
+			target = defaultTargetCPU
+		}
+
+		scaling.metrics = []autoscalingv2.MetricSpec{
+			{
+				Type: autoscalingv2.ResourceMetricSourceType,
+				Resource: &autoscalingv2.ResourceMetricSource{
+					Name: corev1.ResourceCPU,
+					Target: autoscalingv2.MetricTarget{
+						Type:               autoscalingv2.UtilizationMetricType,
+						AverageUtilization: &target,
+					},
+				},
+			},
+		}
+	}
+
+	return scaling
+}
+
+// needsCPURequest reports whether the HorizontalPodAutoscaler measures CPU utilization, which is relative to requests.
+func (scaling *autoscaling) needsCPURequest() bool {
+	for i := range scaling.metrics {
+		metric := &scaling.metrics[i]
+		if metric.Type == autoscalingv2.ResourceMetricSourceType && metric.Resource != nil &&
+			metric.Resource.Name == corev1.ResourceCPU && metric.Resource.Target.Type == autoscalingv2.UtilizationMetricType {
+			return true
+		}
+	}
+
+	return false
 }
 
 func getControllerPort(msvc *microservice) (int, error) {
@@ -129,6 +239,23 @@ func getControllerPort(msvc *microservice) (int, error) {
 	return msvc.services[0].ports[0], nil
 }
 
+func newDBCredentialsSecret(namespace, name string, db *cpv3.Database) corev1.Secret {
+	return corev1.Secret{
+		Type: corev1.SecretTypeOpaque,
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		StringData: map[string]string{
+			controllerDBDBNameSecretKey:   db.DatabaseName,
+			controllerDBHostSecretKey:     db.Host,
+			controllerDBPortSecretKey:     strconv.Itoa(db.Port),
+			controllerDBUserSecretKey:     db.User,
+			controllerDBPasswordSecretKey: db.Password,
+		},
+	}
+}
+
 func newControllerMicroservice(namespace string, cfg *controllerMicroserviceConfig) *microservice {
 	filterControllerConfig(cfg)
 
@@ -146,27 +273,16 @@ func newControllerMicroservice(namespace string, cfg *controllerMicroserviceConf
 				serviceType:      cfg.serviceType,
 				trafficPolicy:    getTrafficPolicy(cfg.serviceType),
 				loadBalancerAddr: cfg.loadBalancerAddr,
+				ipFamilies:       cfg.ipFamilies,
+				ipFamilyPolicy:   cfg.ipFamilyPolicy,
 				ports: []int{
-					51121,
-					80,
+					controllerAPIPort,
+					controllerViewerPort,
 				},
 			},
 		},
 		secrets: []corev1.Secret{
-			{
-				Type: corev1.SecretTypeOpaque,
-				ObjectMeta: metav1.ObjectMeta{
-					Namespace: namespace,
-					Name:      controllerDBCredentialsSecretName,
-				},
-				StringData: map[string]string{
-					controllerDBDBNameSecretKey:   cfg.db.DatabaseName,
-					controllerDBHostSecretKey:     cfg.db.Host,
-					controllerDBPortSecretKey:     strconv.Itoa(cfg.db.Port),
-					controllerDBUserSecretKey:     cfg.db.User,
-					controllerDBPasswordSecretKey: cfg.db.Password,
-				},
-			},
+			newDBCredentialsSecret(namespace, controllerDBCredentialsSecretName, cfg.db),
 			{
 				Type: corev1.SecretTypeOpaque,
 				ObjectMeta: metav1.ObjectMeta{
@@ -188,7 +304,7 @@ func newControllerMicroservice(namespace string, cfg *controllerMicroserviceConf
 					ProbeHandler: corev1.ProbeHandler{
 						HTTPGet: &corev1.HTTPGetAction{
 							Path: "/api/v3/status",
-							Port: intstr.FromInt(51121), //nolint:gomnd
+							Port: intstr.FromInt(controllerAPIPort),
 						},
 					},
 					InitialDelaySeconds: 10,
@@ -321,44 +437,108 @@ func newControllerMicroservice(namespace string, cfg *controllerMicroserviceConf
 						},
 					},
 				},
-				// resources: corev1.ResourceRequirements{
-				// 	Limits: corev1.ResourceList{
-				// 		"cpu":    resource.MustParse("1800m"),
-				// 		"memory": resource.MustParse("3Gi"),
-				// 	},
-				// 	Requests: corev1.ResourceList{
-				// 		"cpu":    resource.MustParse("400m"),
-				// 		"memory": resource.MustParse("1Gi"),
-				// 	},
-				// },
+				resources: cfg.resources,
 			},
 		},
 	}
 
+	if cfg.autoscaling != nil {
+		msvc.autoscaling = newAutoscaling(cfg.autoscaling)
+		msvc.replicas = msvc.autoscaling.minReplicas
+
+		resources := &msvc.containers[0].resources
+		if _, found := resources.Requests[corev1.ResourceCPU]; !found && msvc.autoscaling.needsCPURequest() {
+			resources.Requests = resources.Requests.DeepCopy()
+			if resources.Requests == nil {
+				resources.Requests = corev1.ResourceList{}
+			}
+
+			resources.Requests[corev1.ResourceCPU] = resource.MustParse(defaultCPURequest)
+		}
+	}
+
+	msvc.spreadReplicas = msvc.autoscaling != nil || msvc.replicas > 1
+
 	// Add PVC details if no external DB provided
 	if cfg.db.Host == "" {
 		msvc.mustRecreateOnRollout = true
+		msvc.storage = storage{
+			size:             cfg.storage.Size,
+			storageClassName: cfg.storage.StorageClassName,
+			accessModes:      cfg.storage.AccessModes,
+			annotations:      cfg.storage.Annotations,
+		}
 		msvc.volumes = append(msvc.volumes, corev1.Volume{
-			Name: "controller-sqlite",
+			Name: controllerSqliteVolumeName,
 			VolumeSource: corev1.VolumeSource{
 				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-					ClaimName: "controller-sqlite",
+					ClaimName: controllerSqliteVolumeName,
 					ReadOnly:  false,
 				},
 			},
 		})
 
 		msvc.containers[0].volumeMounts = append(msvc.containers[0].volumeMounts, corev1.VolumeMount{
-			Name:      "controller-sqlite",
-			MountPath: "/usr/local/lib/node_modules/@iofog/iofogcontroller/src/data/sqlite_files/",
-			SubPath:   "prod_database.sqlite",
+			Name:      controllerSqliteVolumeName,
+			MountPath: controllerSqliteMountPath,
+			SubPath:   controllerSqliteSubPath,
 		})
 	}
 
 	return msvc
 }
 
+// setControllerTLS serves the API of the Controller over HTTPS with the certificate of secretName.
+// caKey is the key of the secret holding its CA and checksum identifies the certificate.
+func setControllerTLS(msvc *microservice, secretName, caKey, checksum string) {
+	msvc.services[0].appProtocols = map[int]string{
+		controllerAPIPort: "https",
+	}
+
+	if msvc.annotations == nil {
+		msvc.annotations = map[string]string{}
+	}
+
+	msvc.annotations[tlsChecksumAnnotation] = checksum
+
+	msvc.volumes = append(msvc.volumes, corev1.Volume{
+		Name: controllerTLSVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName,
+			},
+		},
+	})
+
+	cont := &msvc.containers[0]
+	cont.readinessProbe.HTTPGet.Scheme = corev1.URISchemeHTTPS
+	cont.volumeMounts = append(cont.volumeMounts, corev1.VolumeMount{
+		Name:      controllerTLSVolumeName,
+		MountPath: controllerTLSMountPath,
+		ReadOnly:  true,
+	})
+	cont.env = append(cont.env,
+		corev1.EnvVar{
+			Name:  "Server_DevMode",
+			Value: "false",
+		},
+		corev1.EnvVar{
+			Name:  "Server_SslCert",
+			Value: path.Join(controllerTLSMountPath, iofog.TLSCertSecretKey),
+		},
+		corev1.EnvVar{
+			Name:  "Server_SslKey",
+			Value: path.Join(controllerTLSMountPath, iofog.TLSKeySecretKey),
+		},
+		corev1.EnvVar{
+			Name:  "Server_IntermediateCert",
+			Value: path.Join(controllerTLSMountPath, caKey),
+		},
+	)
+}
+
 type portManagerConfig struct {
+	replicas         int32
 	image            string
 	proxyImage       string
 	httpProxyAddress string
@@ -366,9 +546,14 @@ type portManagerConfig struct {
 	watchNamespace   string
 	userEmail        string
 	userPass         string
+	resources        corev1.ResourceRequirements
 }
 
 func filterPortManagerConfig(cfg *portManagerConfig) {
+	if cfg.replicas == 0 {
+		cfg.replicas = 1
+	}
+
 	if cfg.image == "" {
 		cfg.image = util.GetPortManagerImage()
 	}
@@ -387,7 +572,8 @@ func newPortManagerMicroservice(cfg *portManagerConfig) *microservice {
 		labels: map[string]string{
 			"name": "port-manager",
 		},
-		replicas: 1,
+		replicas:       cfg.replicas,
+		spreadReplicas: cfg.replicas > 1,
 		rbacRules: []rbacv1.PolicyRule{
 			{
 				Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
@@ -428,16 +614,7 @@ func newPortManagerMicroservice(cfg *portManagerConfig) *microservice {
 					PeriodSeconds:       5,
 					FailureThreshold:    2,
 				},
-				// resources: corev1.ResourceRequirements{
-				// 	 Limits: corev1.ResourceList{
-				// 	 	"cpu":    resource.MustParse("200m"),
-				// 	 	"memory": resource.MustParse("1Gi"),
-				// 	 },
-				// 	 Requests: corev1.ResourceList{
-				// 	 	"cpu":    resource.MustParse("50m"),
-				// 	 	"memory": resource.MustParse("200Mi"),
-				// 	 },
-				// },
+				resources:    cfg.resources,
 				volumeMounts: []corev1.VolumeMount{},
 				env: []corev1.EnvVar{
 					{
@@ -503,6 +680,8 @@ func newPortManagerMicroservice(cfg *portManagerConfig) *microservice {
 type routerMicroserviceConfig struct {
 	image           string
 	serviceType     string
+	ipFamilies      []corev1.IPFamily
+	ipFamilyPolicy  *corev1.IPFamilyPolicy
 	volumeMountPath string
 }
 
@@ -520,9 +699,13 @@ func filterRouterConfig(cfg routerMicroserviceConfig) routerMicroserviceConfig {
 
 func newRouterMicroservice(cfg routerMicroserviceConfig) *microservice {
 	cfg = filterRouterConfig(cfg)
+	hostNetwork := isHostNetwork(cfg.serviceType)
 
 	return &microservice{
 		name: routerName,
+		// The ports of the node are only free once the previous Router is gone
+		mustRecreateOnRollout: hostNetwork,
+		hostNetwork:           hostNetwork,
 		labels: map[string]string{
 			"name":                 routerName,
 			"application":          "interior-router",
@@ -534,9 +717,11 @@ func newRouterMicroservice(cfg routerMicroserviceConfig) *microservice {
 		},
 		services: []service{
 			{
-				name:          "router",
-				serviceType:   cfg.serviceType,
-				trafficPolicy: getTrafficPolicy(cfg.serviceType),
+				name:           "router",
+				serviceType:    getServiceType(cfg.serviceType),
+				trafficPolicy:  getTrafficPolicy(cfg.serviceType),
+				ipFamilies:     cfg.ipFamilies,
+				ipFamilyPolicy: cfg.ipFamilyPolicy,
 				ports: []int{
 					router.MessagePort,
 					router.InteriorPort,
@@ -601,7 +786,7 @@ func newRouterMicroservice(cfg routerMicroserviceConfig) *microservice {
 					},
 					{
 						Name:  "QDROUTERD_CONF",
-						Value: router.GetConfig(),
+						Value: router.GetConfig(hasIPv6(cfg.ipFamilies)),
 					},
 					{
 						Name: "POD_NAMESPACE",
@@ -645,6 +830,29 @@ func newRouterMicroservice(cfg routerMicroserviceConfig) *microservice {
 	}
 }
 
+func hasIPv6(families []corev1.IPFamily) bool {
+	for _, family := range families {
+		if family == corev1.IPv6Protocol {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isHostNetwork(serviceType string) bool {
+	return strings.EqualFold(serviceType, cpv3.ServiceTypeHostNetwork)
+}
+
+// getServiceType returns the type of the Kubernetes Service, components on the host network are still reachable in cluster.
+func getServiceType(serviceType string) string {
+	if isHostNetwork(serviceType) {
+		return string(corev1.ServiceTypeClusterIP)
+	}
+
+	return serviceType
+}
+
 func getTrafficPolicy(serviceType string) string {
 	if strings.EqualFold(serviceType, string(corev1.ServiceTypeLoadBalancer)) {
 		return string(corev1.ServiceExternalTrafficPolicyTypeLocal)
@@ -0,0 +1,502 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	op "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/k8s/operator"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/util"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	migrationSecretName    = "controller-db-migration" //nolint:gosec
+	migrationSchemaJobName = "controller-db-schema"
+	migrationCopyJobName   = "controller-db-migration"
+	migrationVerifyJobName = "controller-db-verify"
+	migrationVolumeName    = "migration"
+	migrationMountPath     = "/migration"
+	migrationPollDelay     = 5 * time.Second
+	sqliteDatabaseFile     = sqliteDataMountPath + "/prod_database.sqlite"
+	controllerServerFile   = "/usr/local/lib/node_modules/@iofog/iofogcontroller/src/server.js"
+)
+
+// Scripts only reference environment variables so that user input never ends up in a shell command line.
+const (
+	// The Controller creates its schema before it serves its API, it is stopped once the API answers
+	controllerSchemaScript = `node "$CONTROLLER_SERVER" &
+controller=$!
+until node -e "require('http').get('http://localhost:$CONTROLLER_PORT/api/v3/status', (res) => process.exit(res.statusCode === 200 ? 0 : 1)).on('error', () => process.exit(1))"; do
+  kill -0 $controller || exit 1
+  sleep 2
+done
+kill $controller`
+	// Rows seeded by the Controller are truncated, triggers are disabled so that foreign keys do not depend on the order tables are loaded in
+	postgresMigrateScript = `pgloader --with "data only" --with truncate --with "disable triggers" --with "quote identifiers" ` +
+		`"sqlite://$SQLITE_FILE" "postgresql://$DB_USERNAME@$DB_HOST:$DB_PORT/$DB_NAME"`
+	sqliteCountScript = `sqlite3 "$SQLITE_FILE" "SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'" |
+while read -r table; do
+  echo "$table $(sqlite3 "$SQLITE_FILE" "SELECT COUNT(*) FROM \"$table\"")"
+done > /migration/counts`
+	// The summary written to the termination log ends up in the ControlPlane status
+	postgresVerifyScript = `status=0
+while read -r table expected; do
+  actual=$(psql -tA -h "$DB_HOST" -p "$DB_PORT" -U "$DB_USERNAME" -d "$DB_NAME" -c "SELECT COUNT(*) FROM \"$table\"") || actual=missing
+  if [ "$actual" != "$expected" ]; then
+    echo "table $table has $actual rows, expected $expected"
+    status=1
+  fi
+done < /migration/counts > /dev/termination-log
+if [ $status -eq 0 ]; then
+  echo "verified row counts of $(wc -l < /migration/counts) tables" > /dev/termination-log
+fi
+exit $status`
+)
+
+func validateMigration(db *cpv3.Database) error {
+	if db.Provider != dbProviderPostgres {
+		return fmt.Errorf("migrating from sqlite to database provider %s is not supported, only %s", db.Provider, dbProviderPostgres)
+	}
+
+	return nil
+}
+
+func newMigrationJob(namespace, name, imagePullSecret string, initContainers, containers []corev1.Container) *batchv1.Job {
+	labels := map[string]string{
+		"name": name,
+	}
+	backoffLimit := int32(backupJobBackoffLimit)
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy:  corev1.RestartPolicyNever,
+		InitContainers: initContainers,
+		Containers:     containers,
+		Volumes: []corev1.Volume{
+			newSqliteVolume(true),
+			{
+				Name:         migrationVolumeName,
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			},
+		},
+	}
+
+	if imagePullSecret != "" {
+		podSpec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: imagePullSecret}}
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+// newDatabaseSchemaJob starts the Controller of ms against the external database once, so that it creates its schema.
+func newDatabaseSchemaJob(namespace, imagePullSecret string, ms *microservice, db *cpv3.Database) *batchv1.Job {
+	cont := &ms.containers[0]
+	env := []corev1.EnvVar{
+		{Name: "CONTROLLER_SERVER", Value: controllerServerFile},
+		{Name: "CONTROLLER_PORT", Value: strconv.Itoa(controllerAPIPort)},
+	}
+
+	// The Controller still runs on sqlite, so its database settings are replaced by the ones of the migration
+	for _, envVar := range cont.env {
+		switch {
+		case envVar.Name == "DB_PROVIDER":
+			envVar.Value = db.Provider
+		case envVar.ValueFrom != nil && envVar.ValueFrom.SecretKeyRef != nil && envVar.ValueFrom.SecretKeyRef.Name == controllerDBCredentialsSecretName:
+			envVar = secretKeyEnv(envVar.Name, migrationSecretName, envVar.ValueFrom.SecretKeyRef.Key)
+		}
+
+		env = append(env, envVar)
+	}
+
+	return newMigrationJob(namespace, migrationSchemaJobName, imagePullSecret, nil, []corev1.Container{
+		{
+			Name:    "schema",
+			Image:   cont.image,
+			Command: []string{"/bin/sh", "-c", controllerSchemaScript},
+			Env:     env,
+		},
+	})
+}
+
+// newDatabaseCopyJob copies the rows of the sqlite database into the schema the Controller created in the external database.
+func newDatabaseCopyJob(namespace, imagePullSecret string, db *cpv3.Database) *batchv1.Job {
+	return newMigrationJob(namespace, migrationCopyJobName, imagePullSecret, nil, []corev1.Container{
+		{
+			Name:    "copy",
+			Image:   util.GetMigrationImage(),
+			Command: []string{"/bin/sh", "-c", postgresMigrateScript},
+			Env: append(getDBEnv(db, migrationSecretName),
+				corev1.EnvVar{Name: "SQLITE_FILE", Value: sqliteDatabaseFile},
+			),
+			VolumeMounts: []corev1.VolumeMount{newSqliteVolumeMount(true)},
+		},
+	})
+}
+
+// newDatabaseVerifyJob compares the row count of every sqlite table with the external database.
+func newDatabaseVerifyJob(namespace, imagePullSecret string, db *cpv3.Database) *batchv1.Job {
+	migrationMount := corev1.VolumeMount{Name: migrationVolumeName, MountPath: migrationMountPath}
+
+	return newMigrationJob(namespace, migrationVerifyJobName, imagePullSecret,
+		[]corev1.Container{
+			{
+				Name:         "count",
+				Image:        util.GetSqliteImage(),
+				Command:      []string{"/bin/sh", "-c", sqliteCountScript},
+				Env:          []corev1.EnvVar{{Name: "SQLITE_FILE", Value: sqliteDatabaseFile}},
+				VolumeMounts: []corev1.VolumeMount{newSqliteVolumeMount(true), migrationMount},
+			},
+		},
+		[]corev1.Container{
+			{
+				Name:                     "verify",
+				Image:                    util.GetPostgresImage(db.Version),
+				Command:                  []string{"/bin/sh", "-c", postgresVerifyScript},
+				Env:                      getDBEnv(db, migrationSecretName),
+				VolumeMounts:             []corev1.VolumeMount{migrationMount},
+				TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+			},
+		})
+}
+
+// needsDatabaseMigration reports whether the Controller still runs on sqlite although an external database is configured.
+func (r *reconcileContext) needsDatabaseMigration(ctx context.Context) (bool, error) {
+	db := &r.cp.Spec.Database
+	if !isExternalDB(db) {
+		return false, nil
+	}
+
+	// Failed migrations are only retried once the target changes, the Controller keeps running on sqlite meanwhile
+	if r.cp.IsMigratingTo(db) && r.cp.Status.DatabaseMigration.Phase == cpv3.MigrationPhaseFailed {
+		return false, nil
+	}
+
+	found := &corev1.Secret{}
+
+	err := r.Client.Get(ctx, types.NamespacedName{Name: controllerDBCredentialsSecretName, Namespace: r.cp.Namespace}, found)
+	if k8serrors.IsNotFound(err) {
+		// New ControlPlane, there is no sqlite data to migrate
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return len(found.Data[controllerDBHostSecretKey]) == 0, nil
+}
+
+// getControllerDatabase keeps the Controller on sqlite until its data has been migrated to the external database.
+func (r *reconcileContext) getControllerDatabase() *cpv3.Database {
+	if r.cp.IsMigratingTo(&r.cp.Spec.Database) && r.cp.Status.DatabaseMigration.Phase != cpv3.MigrationPhaseCompleted {
+		return &cpv3.Database{}
+	}
+
+	return &r.cp.Spec.Database
+}
+
+func (r *reconcileContext) reconcileMigratingDatabase(ctx context.Context) op.Reconciliation {
+	migration := r.cp.Status.DatabaseMigration
+	if migration == nil || !r.cp.IsMigratingTo(&r.cp.Spec.Database) || migration.Phase == cpv3.MigrationPhaseCompleted {
+		return r.startDatabaseMigration(ctx)
+	}
+
+	r.log.Info(fmt.Sprintf("reconcileMigratingDatabase() ControlPlane %s phase %s", r.cp.Name, migration.Phase))
+
+	switch migration.Phase {
+	case cpv3.MigrationPhaseStopping:
+		return r.reconcileMigrationStopping(ctx)
+	case cpv3.MigrationPhaseCreatingSchema:
+		return r.reconcileMigrationCreatingSchema(ctx)
+	case cpv3.MigrationPhaseCopying:
+		return r.reconcileMigrationCopying(ctx)
+	case cpv3.MigrationPhaseVerifying:
+		return r.reconcileMigrationVerifying(ctx)
+	case cpv3.MigrationPhaseSwitchingOver:
+		return r.reconcileMigrationSwitchingOver(ctx)
+	default:
+		return r.failDatabaseMigration(ctx, fmt.Sprintf("unknown migration phase %s", migration.Phase))
+	}
+}
+
+func (r *reconcileContext) startDatabaseMigration(ctx context.Context) op.Reconciliation {
+	db := &r.cp.Spec.Database
+
+	r.log.Info(fmt.Sprintf("Migrating ControlPlane %s from sqlite to %s", r.cp.Name, db.Endpoint()))
+
+	now := metav1.Now()
+	r.cp.Status.DatabaseMigration = &cpv3.DatabaseMigrationStatus{
+		Target:    db.Endpoint(),
+		StartTime: &now,
+	}
+
+	if err := validateMigration(db); err != nil {
+		return r.failDatabaseMigration(ctx, err.Error())
+	}
+
+	// Jobs of a previous attempt would otherwise be mistaken for this one
+	for _, name := range []string{migrationSchemaJobName, migrationCopyJobName, migrationVerifyJobName} {
+		if err := r.deleteJob(ctx, name); err != nil {
+			return op.ReconcileWithError(err)
+		}
+	}
+
+	secret := newDBCredentialsSecret(r.cp.Namespace, migrationSecretName, db)
+	if err := r.createOrUpdateSecret(ctx, &secret); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	return r.setMigrationPhase(ctx, cpv3.MigrationPhaseStopping, "")
+}
+
+func (r *reconcileContext) reconcileMigrationStopping(ctx context.Context) op.Reconciliation {
+	// sqlite must not change while it is being copied
+	stopped, err := scaleDeployment(ctx, r.Client, r.cp.Namespace, controllerName, 0)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return op.ReconcileWithError(err)
+	}
+
+	if !stopped && err == nil {
+		return op.ReconcileWithRequeue(migrationPollDelay)
+	}
+
+	job := newDatabaseSchemaJob(r.cp.Namespace, r.cp.Spec.Images.PullSecret, r.getControllerMicroservice(), &r.cp.Spec.Database)
+	if err := r.createJob(ctx, job); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	return r.setMigrationPhase(ctx, cpv3.MigrationPhaseCreatingSchema, "")
+}
+
+func (r *reconcileContext) reconcileMigrationCreatingSchema(ctx context.Context) op.Reconciliation {
+	finished, err := r.getJobResult(ctx, migrationSchemaJobName)
+	if err != nil {
+		return r.failDatabaseMigration(ctx, err.Error())
+	}
+
+	if !finished {
+		return op.ReconcileWithRequeue(migrationPollDelay)
+	}
+
+	job := newDatabaseCopyJob(r.cp.Namespace, r.cp.Spec.Images.PullSecret, &r.cp.Spec.Database)
+	if err := r.createJob(ctx, job); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	return r.setMigrationPhase(ctx, cpv3.MigrationPhaseCopying, "")
+}
+
+func (r *reconcileContext) reconcileMigrationCopying(ctx context.Context) op.Reconciliation {
+	finished, err := r.getJobResult(ctx, migrationCopyJobName)
+	if err != nil {
+		return r.failDatabaseMigration(ctx, err.Error())
+	}
+
+	if !finished {
+		return op.ReconcileWithRequeue(migrationPollDelay)
+	}
+
+	job := newDatabaseVerifyJob(r.cp.Namespace, r.cp.Spec.Images.PullSecret, &r.cp.Spec.Database)
+	if err := r.createJob(ctx, job); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	return r.setMigrationPhase(ctx, cpv3.MigrationPhaseVerifying, "")
+}
+
+func (r *reconcileContext) reconcileMigrationVerifying(ctx context.Context) op.Reconciliation {
+	finished, err := r.getJobResult(ctx, migrationVerifyJobName)
+	summary := r.getJobTerminationMessage(ctx, migrationVerifyJobName)
+
+	if err != nil {
+		if summary != "" {
+			return r.failDatabaseMigration(ctx, fmt.Sprintf("%s: %s", err.Error(), summary))
+		}
+
+		return r.failDatabaseMigration(ctx, err.Error())
+	}
+
+	if !finished {
+		return op.ReconcileWithRequeue(migrationPollDelay)
+	}
+
+	return r.setMigrationPhase(ctx, cpv3.MigrationPhaseSwitchingOver, summary)
+}
+
+func (r *reconcileContext) reconcileMigrationSwitchingOver(ctx context.Context) op.Reconciliation {
+	// Once the credentials point to the external database, needsDatabaseMigration no longer holds
+	secret := newDBCredentialsSecret(r.cp.Namespace, controllerDBCredentialsSecretName, &r.cp.Spec.Database)
+	if err := r.createOrUpdateSecret(ctx, &secret); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	if err := r.deleteSecret(ctx, migrationSecretName); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	// The sqlite claim is kept so that nothing is lost if the migration has to be rolled back by hand
+	now := metav1.Now()
+	r.cp.Status.DatabaseMigration.CompletionTime = &now
+
+	// Redeploy the Controller against the external database
+	r.cp.SetConditionDeploying(&r.log)
+
+	return r.setMigrationPhase(ctx, cpv3.MigrationPhaseCompleted, r.cp.Status.DatabaseMigration.Message)
+}
+
+// failDatabaseMigration brings the Controller back up on sqlite.
+func (r *reconcileContext) failDatabaseMigration(ctx context.Context, msg string) op.Reconciliation {
+	replicas := r.cp.Spec.Replicas.Controller
+	if replicas == 0 {
+		replicas = 1
+	}
+
+	if _, err := scaleDeployment(ctx, r.Client, r.cp.Namespace, controllerName, replicas); err != nil && !k8serrors.IsNotFound(err) {
+		return op.ReconcileWithError(err)
+	}
+
+	if err := r.deleteSecret(ctx, migrationSecretName); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	now := metav1.Now()
+	r.cp.Status.DatabaseMigration.CompletionTime = &now
+
+	return r.setMigrationPhase(ctx, cpv3.MigrationPhaseFailed, msg)
+}
+
+func (r *reconcileContext) setMigrationPhase(ctx context.Context, phase, msg string) op.Reconciliation {
+	r.log.Info(fmt.Sprintf("ControlPlane %s database migration phase %s -> %s %s", r.cp.Name, r.cp.Status.DatabaseMigration.Phase, phase, msg))
+
+	r.cp.Status.DatabaseMigration.Phase = phase
+	r.cp.Status.DatabaseMigration.Message = msg
+
+	if err := r.Status().Update(ctx, r.cp); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	// The status update triggers the next step
+	return op.Reconcile()
+}
+
+func (r *reconcileContext) getJobResult(ctx context.Context, name string) (bool, error) {
+	job := &batchv1.Job{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: r.cp.Namespace}, job); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return true, fmt.Errorf("job %s was deleted", name)
+		}
+
+		return false, err
+	}
+
+	return getJobResult(job)
+}
+
+// getJobTerminationMessage returns the termination message of the last container which wrote one.
+func (r *reconcileContext) getJobTerminationMessage(ctx context.Context, name string) string {
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods, client.InNamespace(r.cp.Namespace), client.MatchingLabels{"job-name": name}); err != nil {
+		return ""
+	}
+
+	msg := ""
+
+	for i := range pods.Items {
+		for _, status := range pods.Items[i].Status.ContainerStatuses {
+			if status.State.Terminated != nil && status.State.Terminated.Message != "" {
+				msg = strings.TrimSpace(status.State.Terminated.Message)
+			}
+		}
+	}
+
+	return msg
+}
+
+func (r *reconcileContext) createJob(ctx context.Context, job *batchv1.Job) error {
+	// Set ControlPlane instance as the owner and controller
+	if err := controllerutil.SetControllerReference(r.cp, job, r.Scheme); err != nil {
+		return err
+	}
+
+	r.log.Info("Creating a new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+
+	if err := r.Client.Create(ctx, job); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (r *reconcileContext) deleteJob(ctx context.Context, name string) error {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.cp.Namespace,
+		},
+	}
+
+	return client.IgnoreNotFound(r.Client.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)))
+}
+
+func (r *reconcileContext) createOrUpdateSecret(ctx context.Context, secret *corev1.Secret) error {
+	// Set ControlPlane instance as the owner and controller
+	if err := controllerutil.SetControllerReference(r.cp, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	err := r.Client.Update(ctx, secret)
+	if k8serrors.IsNotFound(err) {
+		return r.Client.Create(ctx, secret)
+	}
+
+	return err
+}
+
+func (r *reconcileContext) deleteSecret(ctx context.Context, name string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.cp.Namespace,
+		},
+	}
+
+	return client.IgnoreNotFound(r.Client.Delete(ctx, secret))
+}
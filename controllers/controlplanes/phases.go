@@ -0,0 +1,259 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	op "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/k8s/operator"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+)
+
+// Components are polled this often while their dependents wait for them to become ready
+const phaseReadyPollDelay = 5 * time.Second
+
+var errPhaseGraph = errors.New("invalid phase graph")
+
+// readyFunc reports whether a reconciled component can serve its dependents, and why not.
+// It may record details of its check in the status of the component.
+type readyFunc = func(ctx context.Context, status *cpv3.ComponentStatus) (ready bool, msg string, err error)
+
+// phase deploys one component of the ControlPlane once the components it depends on are ready.
+type phase struct {
+	name      string
+	dependsOn []string
+	reconcile reconcileFunc
+	ready     readyFunc
+}
+
+type phaseResult struct {
+	recon  op.Reconciliation
+	status cpv3.ComponentStatus
+}
+
+// validatePhases checks that every dependency is known and that the dependencies do not form a cycle.
+func validatePhases(phases []phase) error {
+	byName := make(map[string]*phase, len(phases))
+
+	for idx := range phases {
+		if _, found := byName[phases[idx].name]; found {
+			return fmt.Errorf("%w: duplicate phase %s", errPhaseGraph, phases[idx].name)
+		}
+
+		byName[phases[idx].name] = &phases[idx]
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(phases))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("%w: dependency cycle through %s", errPhaseGraph, name)
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+
+		for _, dep := range byName[name].dependsOn {
+			if _, found := byName[dep]; !found {
+				return fmt.Errorf("%w: phase %s depends on unknown phase %s", errPhaseGraph, name, dep)
+			}
+
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		state[name] = visited
+
+		return nil
+	}
+
+	for idx := range phases {
+		if err := visit(phases[idx].name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runPhase reconciles a component and, once reconciled, checks whether it is ready.
+func runPhase(ctx context.Context, p *phase) phaseResult {
+	status := cpv3.ComponentStatus{
+		Name:      p.name,
+		Phase:     cpv3.ComponentPhaseReconciling,
+		DependsOn: p.dependsOn,
+	}
+
+	recon := p.reconcile(ctx)
+	if recon.Err != nil {
+		status.Phase = cpv3.ComponentPhaseFailed
+		status.Message = recon.Err.Error()
+		recon.Err = fmt.Errorf("reconcile %s: %w", p.name, recon.Err)
+
+		return phaseResult{recon: recon, status: status}
+	}
+
+	if recon.IsFinal() {
+		return phaseResult{recon: recon, status: status}
+	}
+
+	ready, msg, err := p.ready(ctx, &status)
+	if err != nil {
+		status.Phase = cpv3.ComponentPhaseFailed
+		status.Message = err.Error()
+
+		return phaseResult{recon: op.ReconcileWithError(fmt.Errorf("check %s readiness: %w", p.name, err)), status: status}
+	}
+
+	if !ready {
+		status.Phase = cpv3.ComponentPhaseWaiting
+		status.Message = msg
+
+		return phaseResult{recon: op.ReconcileWithRequeue(phaseReadyPollDelay), status: status}
+	}
+
+	status.Phase = cpv3.ComponentPhaseReady
+
+	return phaseResult{recon: recon, status: status}
+}
+
+// mergeReconciliations keeps every error, ends if any ends, and requeues after the longest delay.
+func mergeReconciliations(recons []op.Reconciliation) op.Reconciliation {
+	merged := op.Reconciliation{}
+	errs := []error{}
+
+	for _, recon := range recons {
+		if recon.Err != nil {
+			errs = append(errs, recon.Err)
+		}
+
+		if recon.End {
+			merged.End = true
+		}
+
+		if recon.Requeue {
+			merged.Requeue = true
+			if recon.Delay > merged.Delay {
+				merged.Delay = recon.Delay
+			}
+		}
+	}
+
+	merged.Err = errors.Join(errs...)
+
+	return merged
+}
+
+// runPhases reconciles the phases in dependency order, running independent phases concurrently.
+// A phase only starts once all the phases it depends on are ready, the others are reported as pending.
+func (r *reconcileContext) runPhases(ctx context.Context, phases []phase) op.Reconciliation {
+	if err := validatePhases(phases); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	ready := map[string]bool{}
+	done := map[string]bool{}
+	recons := []op.Reconciliation{}
+
+	for len(done) < len(phases) {
+		runnable := []*phase{}
+
+		for idx := range phases {
+			p := &phases[idx]
+			if done[p.name] {
+				continue
+			}
+
+			if waitingOn := getPendingDependencies(p, ready); len(waitingOn) == 0 {
+				runnable = append(runnable, p)
+			}
+		}
+
+		if len(runnable) == 0 {
+			break
+		}
+
+		results := make([]phaseResult, len(runnable))
+
+		var wg sync.WaitGroup
+
+		for idx := range runnable {
+			wg.Add(1)
+
+			go func(idx int) {
+				defer wg.Done()
+
+				results[idx] = runPhase(ctx, runnable[idx])
+			}(idx)
+		}
+
+		wg.Wait()
+
+		for idx := range results {
+			done[runnable[idx].name] = true
+			ready[runnable[idx].name] = results[idx].status.Phase == cpv3.ComponentPhaseReady
+			recons = append(recons, results[idx].recon)
+
+			r.log.Info(fmt.Sprintf("runPhases() ControlPlane %s component %s is %s", r.cp.Name, results[idx].status.Name, results[idx].status.Phase))
+			r.cp.SetComponentStatus(results[idx].status)
+		}
+	}
+
+	// Phases whose dependencies are not ready are left for a later reconciliation
+	for idx := range phases {
+		p := &phases[idx]
+		if done[p.name] {
+			continue
+		}
+
+		r.cp.SetComponentStatus(cpv3.ComponentStatus{
+			Name:      p.name,
+			Phase:     cpv3.ComponentPhasePending,
+			Message:   fmt.Sprintf("Waiting for %s", strings.Join(getPendingDependencies(p, ready), ", ")),
+			DependsOn: p.dependsOn,
+		})
+	}
+
+	return mergeReconciliations(recons)
+}
+
+func getPendingDependencies(p *phase, ready map[string]bool) []string {
+	pending := []string{}
+
+	for _, dep := range p.dependsOn {
+		if !ready[dep] {
+			pending = append(pending, dep)
+		}
+	}
+
+	return pending
+}
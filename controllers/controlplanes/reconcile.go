@@ -2,35 +2,38 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
 	k8sclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/k8s"
 	op "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/k8s/operator"
-	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
-	"github.com/eclipse-iofog/iofog-operator/v3/controllers/controlplanes/router"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
 	"github.com/skupperproject/skupper-cli/pkg/certs"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 const (
 	loadBalancerTimeout       = 360
 	errProxyRouterMissing     = "missing Proxy.Router data for non LoadBalancer Router service"
-	errParseControllerURL     = "failed to parse Controller endpoint as URL (%s): %s"
 	portManagerDeploymentName = "port-manager"
+	// Seconds, the TLS handshake with the Controller takes longer than a plain request
+	controllerClientTimeout = 3
 )
 
-func reconcileRoutine(ctx context.Context, recon func(context.Context) op.Reconciliation, reconChan chan op.Reconciliation) {
-	reconChan <- recon(ctx)
-}
-
-func (r *ControlPlaneReconciler) updateIofogUserPassword(ctx context.Context, iofogClient *iofogclient.Client) error {
+func (r *reconcileContext) updateIofogUserPassword(ctx context.Context, iofogClient *iofogclient.Client) error {
 	r.log.Info(fmt.Sprintf("Updating user password %s for ControlPlane %s", r.cp.Spec.User.Password, r.cp.Name))
 	// Retrieve old password from secrets
 	found := &corev1.Secret{}
@@ -92,7 +95,7 @@ func (r *ControlPlaneReconciler) updateIofogUserPassword(ctx context.Context, io
 	return nil
 }
 
-func (r *ControlPlaneReconciler) reconcileDBCredentialsSecret(ctx context.Context, ms *microservice) (shouldRestartPod bool, err error) {
+func (r *reconcileContext) reconcileDBCredentialsSecret(ctx context.Context, ms *microservice) (shouldRestartPod bool, err error) {
 	for i := range ms.secrets {
 		secret := &ms.secrets[i]
 
@@ -126,28 +129,38 @@ func (r *ControlPlaneReconciler) reconcileDBCredentialsSecret(ctx context.Contex
 	return false, nil
 }
 
-func (r *ControlPlaneReconciler) reconcileIofogController(ctx context.Context) op.Reconciliation {
-	// Configure Controller
+func (r *reconcileContext) getControllerMicroservice() *microservice {
 	config := &controllerMicroserviceConfig{
 		replicas:          r.cp.Spec.Replicas.Controller,
 		image:             r.cp.Spec.Images.Controller,
 		imagePullSecret:   r.cp.Spec.Images.PullSecret,
 		proxyImage:        r.cp.Spec.Images.Proxy,
 		routerImage:       r.cp.Spec.Images.Router,
-		db:                &r.cp.Spec.Database,
+		db:                r.getControllerDatabase(),
 		serviceType:       r.cp.Spec.Services.Controller.Type,
 		loadBalancerAddr:  r.cp.Spec.Services.Controller.Address,
+		ipFamilies:        r.cp.Spec.Services.Controller.IPFamilies,
+		ipFamilyPolicy:    r.cp.Spec.Services.Controller.IPFamilyPolicy,
 		portAllocatorHost: r.cp.Spec.Controller.PortAllocatorHost,
 		ecn:               r.cp.Spec.Controller.ECNName,
 		pidBaseDir:        r.cp.Spec.Controller.PidBaseDir,
 		ecnViewerPort:     r.cp.Spec.Controller.EcnViewerPort,
-		ecnViewerURL:      r.cp.Spec.Controller.EcnViewerURL,
+		ecnViewerURL:      getEcnViewerURL(r.cp),
 		portProvider:      r.cp.Spec.Controller.PortProvider,
 		proxyBrokerURL:    r.cp.Spec.Controller.ProxyBrokerURL,
 		proxyBrokerToken:  r.cp.Spec.Controller.ProxyBrokerToken,
 		portRouterImage:   r.cp.Spec.Images.PortRouter,
+		storage:           r.cp.Spec.Controller.Storage,
+		resources:         r.cp.Spec.Controller.Resources,
+		autoscaling:       r.cp.Spec.Autoscaling.Controller,
 	}
-	ms := newControllerMicroservice(r.cp.Namespace, config)
+
+	return newControllerMicroservice(r.cp.Namespace, config)
+}
+
+func (r *reconcileContext) reconcileIofogController(ctx context.Context) op.Reconciliation {
+	// Configure Controller
+	ms := r.getControllerMicroservice()
 
 	// Service Account
 	if err := r.createServiceAccount(ctx, ms); err != nil {
@@ -168,11 +181,21 @@ func (r *ControlPlaneReconciler) reconcileIofogController(ctx context.Context) o
 		return op.ReconcileWithError(err)
 	}
 
+	// TLS certificate, before the Service exposes the API over HTTPS
+	if recon := r.reconcileControllerTLS(ctx, ms); recon.IsFinal() {
+		return recon
+	}
+
 	// Service
 	if err := r.createService(ctx, ms); err != nil {
 		return op.ReconcileWithError(err)
 	}
 
+	// Ingress or Gateway API routes
+	if recon := r.reconcileControllerRoutes(ctx, ms); recon.IsFinal() {
+		return recon
+	}
+
 	// PVC
 	if err := r.createPersistentVolumeClaims(ctx, ms); err != nil {
 		return op.ReconcileWithError(err)
@@ -188,6 +211,16 @@ func (r *ControlPlaneReconciler) reconcileIofogController(ctx context.Context) o
 		return op.ReconcileWithError(err)
 	}
 
+	// Autoscaling
+	if recon := r.reconcileControllerAutoscaling(ctx, ms); recon.IsFinal() {
+		return recon
+	}
+
+	// Backup CronJob
+	if recon := r.reconcileBackup(ctx); recon.IsFinal() {
+		return recon
+	}
+
 	// The deployment was just created, requeue to hide latency
 	if !alreadyExists {
 		return op.ReconcileWithRequeue(time.Second * 5) //nolint:gomnd
@@ -198,9 +231,18 @@ func (r *ControlPlaneReconciler) reconcileIofogController(ctx context.Context) o
 		return op.ReconcileWithError(err)
 	}
 
-	host := fmt.Sprintf("%s.%s.svc.cluster.local", ms.name, r.cp.ObjectMeta.Namespace)
-	iofogClient, fin := r.getIofogClient(host, ctrlPort)
+	address, err := iofog.GetControllerAddress(ctx, r.Client, r.cp.Namespace)
+	if err != nil {
+		if errors.Is(err, iofog.ErrControllerUnreachable) {
+			r.log.Info(fmt.Sprintf("Could not reach Controller for ControlPlane %s: %s", r.cp.Name, err.Error()))
+
+			return op.ReconcileWithRequeue(time.Second * 3) //nolint:gomnd
+		}
+
+		return op.ReconcileWithError(err)
+	}
 
+	iofogClient, fin := r.getIofogClient(address)
 	if fin.IsFinal() {
 		return fin
 	}
@@ -220,33 +262,9 @@ func (r *ControlPlaneReconciler) reconcileIofogController(ctx context.Context) o
 		}
 	}
 
-	// Connect to cluster
-	k8sClient, err := newK8sClient()
-	if err != nil {
-		return op.ReconcileWithError(err)
-	}
-
 	// Get Router or Router Proxy
-	var routerProxy cpv3.RouterIngress
-
-	if strings.EqualFold(r.cp.Spec.Services.Router.Type, string(corev1.ServiceTypeLoadBalancer)) {
-		//nolint:contextcheck // k8sClient unfortunately does not accept context
-		routerAddr, err := k8sClient.WaitForLoadBalancer(r.cp.Namespace, routerName, loadBalancerTimeout)
-		if err != nil {
-			return op.ReconcileWithError(err)
-		}
-
-		routerProxy = cpv3.RouterIngress{
-			Address:      routerAddr,
-			MessagePort:  router.MessagePort,
-			InteriorPort: router.InteriorPort,
-			EdgePort:     router.EdgePort,
-		}
-	} else if r.cp.Spec.Ingresses.Router.Address != "" {
-		routerProxy = r.cp.Spec.Ingresses.Router
-	} else {
-		err := fmt.Errorf("reconcile Controller failed: %s", errProxyRouterMissing)
-
+	routerProxy, err := r.getRouterIngress(ctx)
+	if err != nil {
 		return op.ReconcileWithError(err)
 	}
 
@@ -259,13 +277,18 @@ func (r *ControlPlaneReconciler) reconcileIofogController(ctx context.Context) o
 	r.log.Info(fmt.Sprintf("Waiting for IP/LB Service in iofog-controller reconcile for ControlPlane %s", r.cp.Name))
 
 	if strings.EqualFold(r.cp.Spec.Services.Controller.Type, string(corev1.ServiceTypeLoadBalancer)) {
+		k8sClient, err := newK8sClient()
+		if err != nil {
+			return op.ReconcileWithError(err)
+		}
+
 		//nolint:contextcheck // k8sClient unfortunately does not accept context
 		host, err := k8sClient.WaitForLoadBalancer(r.cp.Namespace, controllerName, loadBalancerTimeout)
 		if err != nil {
 			return op.ReconcileWithError(err)
 		}
 		// Check LB connection works
-		if _, fin := r.getIofogClient(host, ctrlPort); fin.IsFinal() {
+		if _, fin := r.getIofogClient(net.JoinHostPort(host, strconv.Itoa(ctrlPort))); fin.IsFinal() {
 			r.log.Info(fmt.Sprintf("LB Connection works for ControlPlane %s", r.cp.Name))
 
 			return fin
@@ -285,20 +308,109 @@ func (r *ControlPlaneReconciler) reconcileIofogController(ctx context.Context) o
 	return op.Continue()
 }
 
-func (r *ControlPlaneReconciler) getIofogClient(host string, port int) (*iofogclient.Client, op.Reconciliation) {
-	baseURL := fmt.Sprintf("http://%s:%d/api/v3", host, port) //nolint:nosprintfhostport
+// reconcileControllerStorage expands the sqlite claim of a running Controller and reports its state.
+func (r *reconcileContext) reconcileControllerStorage(ctx context.Context) op.Reconciliation {
+	if err := r.createPersistentVolumeClaims(ctx, r.getControllerMicroservice()); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	changed, resizing, err := r.updateStorageStatus(ctx)
+	if err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	if changed {
+		if err := r.Status().Update(ctx, r.cp); err != nil {
+			return op.ReconcileWithError(err)
+		}
+	}
+
+	if resizing {
+		r.log.Info(fmt.Sprintf("Waiting for storage expansion of ControlPlane %s", r.cp.Name))
+
+		return op.ReconcileWithRequeue(time.Second * 10) //nolint:gomnd
+	}
+
+	return op.Continue()
+}
+
+func (r *reconcileContext) reconcileControllerAutoscaling(ctx context.Context, ms *microservice) op.Reconciliation {
+	if ms.autoscaling == nil {
+		if r.cp.Spec.Autoscaling.Controller != nil {
+			r.log.Info(fmt.Sprintf("Ignoring autoscaling of Controller for ControlPlane %s, it requires an external database", r.cp.Name))
+		}
+
+		if err := r.deleteResource(ctx, &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: ms.name, Namespace: r.cp.Namespace}}); err != nil {
+			return op.ReconcileWithError(err)
+		}
+
+		if err := r.deleteResource(ctx, &policyv1.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Name: ms.name, Namespace: r.cp.Namespace}}); err != nil {
+			return op.ReconcileWithError(err)
+		}
+
+		return op.Continue()
+	}
+
+	if err := r.createHorizontalPodAutoscaler(ctx, newHorizontalPodAutoscaler(r.cp.Namespace, ms)); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	if err := r.createPodDisruptionBudget(ctx, newPodDisruptionBudget(r.cp.Namespace, ms)); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	return op.Continue()
+}
+
+func (r *reconcileContext) reconcileBackup(ctx context.Context) op.Reconciliation {
+	if r.cp.Spec.Backup.Schedule == "" {
+		if err := r.deleteCronJob(ctx, backupCronJobName); err != nil {
+			return op.ReconcileWithError(err)
+		}
+
+		return op.Continue()
+	}
 
-	parsedURL, err := url.Parse(baseURL)
+	cronJob, err := newBackupCronJob(r.cp.Namespace, &backupConfig{
+		db:              r.getControllerDatabase(),
+		backup:          &r.cp.Spec.Backup,
+		target:          &r.cp.Spec.Backup.Target,
+		imagePullSecret: r.cp.Spec.Images.PullSecret,
+	})
 	if err != nil {
-		return nil, op.ReconcileWithError(fmt.Errorf(errParseControllerURL, baseURL, err.Error()))
+		return op.ReconcileWithError(fmt.Errorf("invalid backup configuration for ControlPlane %s: %w", r.cp.Name, err))
+	}
+
+	if err := r.createCronJob(ctx, cronJob); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	return op.Continue()
+}
+
+// getIofogClient connects to the Controller API on address, a host and port with IPv6 addresses in brackets.
+func (r *reconcileContext) getIofogClient(address string) (*iofogclient.Client, op.Reconciliation) {
+	baseURL := &url.URL{
+		Scheme: "http",
+		Host:   address,
+		Path:   "/api/v3",
+	}
+
+	// The CA of the Controller is read once its certificate is reconciled
+	if r.cp.Spec.Controller.IsTLSEnabled() {
+		baseURL.Scheme = "https"
+
+		if err := iofog.SetControllerTransport(address, r.controllerCA, iofog.GetControllerServerName(r.cp.Namespace)); err != nil {
+			return nil, op.ReconcileWithError(fmt.Errorf("trust CA of the Controller of ControlPlane %s: %w", r.cp.Name, err))
+		}
 	}
 
 	iofogClient := iofogclient.New(iofogclient.Options{
-		BaseURL: parsedURL,
-		Timeout: 1,
+		BaseURL: baseURL,
+		Timeout: controllerClientTimeout,
 	})
 
-	if _, err = iofogClient.GetStatus(); err != nil {
+	if _, err := iofogClient.GetStatus(); err != nil {
 		r.log.Info(fmt.Sprintf("Could not get Controller status for ControlPlane %s: %s", r.cp.Name, err.Error()))
 
 		return nil, op.ReconcileWithRequeue(time.Second * 3) //nolint:gomnd
@@ -307,8 +419,13 @@ func (r *ControlPlaneReconciler) getIofogClient(host string, port int) (*iofogcl
 	return iofogClient, op.Continue()
 }
 
-func (r *ControlPlaneReconciler) reconcilePortManager(ctx context.Context) op.Reconciliation {
+func (r *reconcileContext) reconcilePortManager(ctx context.Context) op.Reconciliation {
+	if err := validateProxyService(&r.cp.Spec.Services.Proxy); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
 	ms := newPortManagerMicroservice(&portManagerConfig{
+		replicas:         r.cp.Spec.Replicas.PortManager,
 		image:            r.cp.Spec.Images.PortManager,
 		proxyImage:       r.cp.Spec.Images.Proxy,
 		httpProxyAddress: r.cp.Spec.Ingresses.HTTPProxy.Address,
@@ -316,6 +433,7 @@ func (r *ControlPlaneReconciler) reconcilePortManager(ctx context.Context) op.Re
 		watchNamespace:   r.cp.ObjectMeta.Namespace,
 		userEmail:        r.cp.Spec.User.Email,
 		userPass:         r.cp.Spec.User.Password,
+		resources:        r.cp.Spec.PortManager.Resources,
 	})
 
 	// Service Account
@@ -348,12 +466,14 @@ func (r *ControlPlaneReconciler) reconcilePortManager(ctx context.Context) op.Re
 	return op.Continue()
 }
 
-func (r *ControlPlaneReconciler) reconcileRouter(ctx context.Context) op.Reconciliation {
+func (r *reconcileContext) reconcileRouter(ctx context.Context) op.Reconciliation {
 	// Configure
 	volumeMountPath := "/etc/qpid-dispatch-certs/"
 	ms := newRouterMicroservice(routerMicroserviceConfig{
 		image:           r.cp.Spec.Images.Router,
 		serviceType:     r.cp.Spec.Services.Router.Type,
+		ipFamilies:      r.cp.Spec.Services.Router.IPFamilies,
+		ipFamilyPolicy:  r.cp.Spec.Services.Router.IPFamilyPolicy,
 		volumeMountPath: volumeMountPath,
 	})
 
@@ -377,36 +497,26 @@ func (r *ControlPlaneReconciler) reconcileRouter(ctx context.Context) op.Reconci
 		return op.ReconcileWithError(err)
 	}
 
-	// Wait for IP
-	k8sClient, err := newK8sClient()
+	// Wait for the external address of the Router
+
+	r.log.Info(fmt.Sprintf("Waiting for IP/LB Service in router reconcile for ControlPlane %s", r.cp.Name))
+
+	ingress, err := r.getRouterIngress(ctx)
 	if err != nil {
 		return op.ReconcileWithError(err)
 	}
 
-	// Wait for external IP of LB Service
-
-	r.log.Info(fmt.Sprintf("Waiting for IP/LB Service in router reconcile for ControlPlane %s", r.cp.Name))
-
-	var address string
+	address := ingress.Address
 
-	if strings.EqualFold(r.cp.Spec.Services.Controller.Type, string(corev1.ServiceTypeLoadBalancer)) {
-		//nolint:contextcheck // k8sClient unfortunately does not accept context
-		address, err = k8sClient.WaitForLoadBalancer(r.cp.ObjectMeta.Namespace, ms.name, loadBalancerTimeout)
-		if err != nil {
-			return op.ReconcileWithError(err)
-		}
-	} else if r.cp.Spec.Ingresses.Router.Address != "" {
-		address = r.cp.Spec.Ingresses.Router.Address
-	} else {
-		err = fmt.Errorf("reconcile Router failed: %s", errProxyRouterMissing)
+	r.log.Info(fmt.Sprintf("Found address %s for router reconcile for Controlplane %s", address, r.cp.Name))
 
+	hosts, err := r.getRouterHosts(ctx, address)
+	if err != nil {
 		return op.ReconcileWithError(err)
 	}
 
-	r.log.Info(fmt.Sprintf("Found address %s for router reconcile for Controlplane %s", address, r.cp.Name))
-
 	// Secrets
-	if err = r.createRouterSecrets(ms, address); err != nil {
+	if err = r.createRouterSecrets(ms, hosts); err != nil {
 		return op.ReconcileWithError(err)
 	}
 
@@ -433,7 +543,8 @@ func (r *ControlPlaneReconciler) reconcileRouter(ctx context.Context) op.Reconci
 	return op.Continue()
 }
 
-func (r *ControlPlaneReconciler) createRouterSecrets(ms *microservice, address string) (err error) {
+// createRouterSecrets generates the certificates of the Router, valid for each of hosts. The first host is their subject.
+func (r *reconcileContext) createRouterSecrets(ms *microservice, hosts []string) (err error) {
 	r.log.Info(fmt.Sprintf("Creating routerSecrets definition for router reconcile for Controlplane %s", r.cp.Name))
 
 	defer func() {
@@ -454,7 +565,7 @@ func (r *ControlPlaneReconciler) createRouterSecrets(ms *microservice, address s
 	// AMQPS and Internal
 	for _, suffix := range []string{"amqps", "internal"} {
 		r.log.Info(fmt.Sprintf("Generating %s Secret secrets for router reconcile for Controlplane %s", suffix, r.cp.Name))
-		secret := certs.GenerateSecret("router-"+suffix, address, address, &caSecret)
+		secret := certs.GenerateSecret("router-"+suffix, hosts[0], strings.Join(hosts, ","), &caSecret)
 		secret.ObjectMeta.Namespace = r.cp.ObjectMeta.Namespace
 		ms.secrets = append(ms.secrets, secret)
 	}
@@ -466,9 +577,14 @@ func (r *ControlPlaneReconciler) createRouterSecrets(ms *microservice, address s
 
 func newK8sClient() (*k8sclient.Client, error) {
 	kubeConf := os.Getenv("KUBECONFIG")
-	if kubeConf == "" {
+	if kubeConf == "" && iofog.IsInCluster() {
 		return k8sclient.NewInCluster()
 	}
 
+	// Operators run out of cluster use the kubeconfig of the user
+	if kubeConf == "" {
+		kubeConf = clientcmd.RecommendedHomeFile
+	}
+
 	return k8sclient.New(kubeConf)
 }
@@ -17,8 +17,11 @@ import (
 	"strconv"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
@@ -35,6 +38,8 @@ func newServices(namespace string, ms *microservice) (svcs []*corev1.Service) {
 				Type:                  corev1.ServiceType(msvcSvc.serviceType),
 				ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyType(msvcSvc.trafficPolicy),
 				LoadBalancerIP:        msvcSvc.loadBalancerAddr,
+				IPFamilies:            msvcSvc.ipFamilies,
+				IPFamilyPolicy:        msvcSvc.ipFamilyPolicy,
 				Selector:              ms.labels,
 			},
 		}
@@ -46,6 +51,11 @@ func newServices(namespace string, ms *microservice) (svcs []*corev1.Service) {
 				TargetPort: intstr.FromInt(port),
 				Protocol:   corev1.Protocol("TCP"),
 			}
+
+			if appProtocol, found := msvcSvc.appProtocols[port]; found {
+				svcPort.AppProtocol = &appProtocol
+			}
+
 			svc.Spec.Ports = append(svc.Spec.Ports, svcPort)
 		}
 
@@ -87,7 +97,8 @@ func newDeployment(namespace string, ms *microservice) *appsv1.Deployment {
 			Strategy: strategy,
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: ms.labels,
+					Labels:      ms.labels,
+					Annotations: ms.annotations,
 				},
 				Spec: corev1.PodSpec{
 					ServiceAccountName: ms.name,
@@ -97,6 +108,30 @@ func newDeployment(namespace string, ms *microservice) *appsv1.Deployment {
 		},
 	}
 
+	if ms.hostNetwork {
+		dep.Spec.Template.Spec.HostNetwork = true
+		dep.Spec.Template.Spec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	}
+
+	// Prefer to keep replicas on separate nodes so a single node failure does not take them all down
+	if ms.spreadReplicas {
+		dep.Spec.Template.Spec.Affinity = &corev1.Affinity{
+			PodAntiAffinity: &corev1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+					{
+						Weight: 100, //nolint:gomnd
+						PodAffinityTerm: corev1.PodAffinityTerm{
+							LabelSelector: &metav1.LabelSelector{
+								MatchLabels: ms.labels,
+							},
+							TopologyKey: corev1.LabelHostname,
+						},
+					},
+				},
+			},
+		}
+	}
+
 	containers := &dep.Spec.Template.Spec.Containers
 	for i := range ms.containers {
 		msCont := &ms.containers[i]
@@ -118,6 +153,85 @@ func newDeployment(namespace string, ms *microservice) *appsv1.Deployment {
 	return dep
 }
 
+func newHorizontalPodAutoscaler(namespace string, ms *microservice) *autoscalingv2.HorizontalPodAutoscaler {
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ms.name,
+			Namespace: namespace,
+			Labels:    ms.labels,
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       ms.name,
+			},
+			MinReplicas: &ms.autoscaling.minReplicas,
+			MaxReplicas: ms.autoscaling.maxReplicas,
+			Metrics:     ms.autoscaling.metrics,
+		},
+	}
+}
+
+func newPodDisruptionBudget(namespace string, ms *microservice) *policyv1.PodDisruptionBudget {
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ms.name,
+			Namespace: namespace,
+			Labels:    ms.labels,
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &ms.autoscaling.maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: ms.labels,
+			},
+		},
+	}
+}
+
+func newPersistentVolumeClaims(namespace string, ms *microservice) (pvcs []*corev1.PersistentVolumeClaim, err error) {
+	for i := range ms.volumes {
+		if ms.volumes[i].VolumeSource.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		storageSize, err := resource.ParseQuantity(ms.storage.size)
+		if err != nil {
+			return nil, err
+		}
+
+		accessModes := make([]corev1.PersistentVolumeAccessMode, len(ms.storage.accessModes))
+		for idx, mode := range ms.storage.accessModes {
+			accessModes[idx] = corev1.PersistentVolumeAccessMode(mode)
+		}
+
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        ms.volumes[i].VolumeSource.PersistentVolumeClaim.ClaimName,
+				Namespace:   namespace,
+				Labels:      ms.labels,
+				Annotations: ms.storage.annotations,
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: accessModes,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: storageSize,
+					},
+				},
+			},
+		}
+
+		if ms.storage.storageClassName != "" {
+			pvc.Spec.StorageClassName = &ms.storage.storageClassName
+		}
+
+		pvcs = append(pvcs, pvc)
+	}
+
+	return pvcs, nil
+}
+
 func newServiceAccount(namespace string, ms *microservice) *corev1.ServiceAccount {
 	return &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,359 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const restorePollDelay = 5 * time.Second
+
+// ControlPlaneRestoreReconciler restores the Controller database of a ControlPlane from a backup.
+type ControlPlaneRestoreReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=iofog.org,resources=controlplanerestores,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=iofog.org,resources=controlplanerestores/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;create;update;patch;delete
+
+func (r *ControlPlaneRestoreReconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("controlplanerestore", request.NamespacedName)
+
+	restore := &cpv3.ControlPlaneRestore{}
+	if err := r.Client.Get(ctx, request.NamespacedName, restore); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	if restore.IsFinished() {
+		return ctrl.Result{}, nil
+	}
+
+	cp := &cpv3.ControlPlane{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: restore.Spec.ControlPlane, Namespace: restore.Namespace}, cp); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return r.setPhase(ctx, restore, cpv3.RestorePhaseFailed, fmt.Sprintf("ControlPlane %s not found", restore.Spec.ControlPlane))
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	log.Info(fmt.Sprintf("Restore of ControlPlane %s in phase %s", cp.Name, restore.Status.Phase))
+
+	switch restore.Status.Phase {
+	case "", cpv3.RestorePhasePending:
+		return r.reconcilePending(ctx, restore, cp)
+	case cpv3.RestorePhaseScalingDown:
+		return r.reconcileScalingDown(ctx, restore, cp)
+	case cpv3.RestorePhaseRestoring:
+		return r.reconcileRestoring(ctx, restore, cp)
+	case cpv3.RestorePhaseScalingUp:
+		return r.reconcileScalingUp(ctx, restore, cp)
+	default:
+		return r.setPhase(ctx, restore, cpv3.RestorePhaseFailed, fmt.Sprintf("unknown phase %s", restore.Status.Phase))
+	}
+}
+
+func (r *ControlPlaneRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cpv3.ControlPlaneRestore{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
+
+func (r *ControlPlaneRestoreReconciler) getBackupConfig(restore *cpv3.ControlPlaneRestore, cp *cpv3.ControlPlane) *backupConfig {
+	target := &cp.Spec.Backup.Target
+	if restore.Spec.Target != nil {
+		target = restore.Spec.Target
+	}
+
+	return &backupConfig{
+		db:              &cp.Spec.Database,
+		backup:          &cp.Spec.Backup,
+		target:          target,
+		imagePullSecret: cp.Spec.Images.PullSecret,
+	}
+}
+
+func (r *ControlPlaneRestoreReconciler) reconcilePending(ctx context.Context, restore *cpv3.ControlPlaneRestore, cp *cpv3.ControlPlane) (ctrl.Result, error) {
+	if _, err := newBackupPodSpec(r.getBackupConfig(restore, cp), restore.Spec.Backup); err != nil {
+		return r.setPhase(ctx, restore, cpv3.RestorePhaseFailed, err.Error())
+	}
+
+	if owner, found := cp.Annotations[cpv3.RestoreInProgressAnnotation]; found && owner != restore.Name {
+		return r.requeueWithMessage(ctx, restore, fmt.Sprintf("waiting for restore %s to finish", owner))
+	}
+
+	// Stop the ControlPlane reconciler from scaling the Controller back up
+	if err := r.setRestoreAnnotation(ctx, cp, restore.Name); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	restore.Status.StartTime = &now
+
+	return r.setPhase(ctx, restore, cpv3.RestorePhaseScalingDown, "")
+}
+
+func (r *ControlPlaneRestoreReconciler) reconcileScalingDown(ctx context.Context, restore *cpv3.ControlPlaneRestore, cp *cpv3.ControlPlane) (ctrl.Result, error) {
+	stopped, err := r.scaleController(ctx, cp, 0)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !stopped {
+		return r.requeueWithMessage(ctx, restore, "waiting for Controller pods to terminate")
+	}
+
+	job, err := newRestoreJob(restore.Namespace, restore.Name, restore.Spec.Backup, r.getBackupConfig(restore, cp))
+	if err != nil {
+		return r.finish(ctx, restore, cp, cpv3.RestorePhaseFailed, err.Error())
+	}
+
+	if err := controllerutil.SetControllerReference(restore, job, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.Client.Create(ctx, job); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+
+	return r.setPhase(ctx, restore, cpv3.RestorePhaseRestoring, "")
+}
+
+func (r *ControlPlaneRestoreReconciler) reconcileRestoring(ctx context.Context, restore *cpv3.ControlPlaneRestore, cp *cpv3.ControlPlane) (ctrl.Result, error) {
+	job := &batchv1.Job{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: restore.Name, Namespace: restore.Namespace}, job); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return r.finish(ctx, restore, cp, cpv3.RestorePhaseFailed, "restore Job was deleted")
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	finished, err := getJobResult(job)
+	if err != nil {
+		// Bring the Controller back even though its database might only be partially restored
+		return r.finish(ctx, restore, cp, cpv3.RestorePhaseFailed, err.Error())
+	}
+
+	if finished {
+		return r.setPhase(ctx, restore, cpv3.RestorePhaseScalingUp, "")
+	}
+
+	return r.requeueWithMessage(ctx, restore, "waiting for restore Job to complete")
+}
+
+// reconcileScalingUp completes the restore once the Controller runs on the restored database and is ready.
+func (r *ControlPlaneRestoreReconciler) reconcileScalingUp(ctx context.Context, restore *cpv3.ControlPlaneRestore, cp *cpv3.ControlPlane) (ctrl.Result, error) {
+	dep, err := r.startController(ctx, cp)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	rollout, msg := getDeploymentRollout(dep)
+
+	switch rollout.Reason {
+	case rolloutReasonComplete:
+		return r.finish(ctx, restore, cp, cpv3.RestorePhaseCompleted, "")
+	case rolloutReasonRollingOut:
+		return r.requeueWithMessage(ctx, restore, msg)
+	default:
+		return r.finish(ctx, restore, cp, cpv3.RestorePhaseFailed, msg)
+	}
+}
+
+// finish restarts the Controller and hands it back to the ControlPlane reconciler.
+func (r *ControlPlaneRestoreReconciler) finish(ctx context.Context, restore *cpv3.ControlPlaneRestore, cp *cpv3.ControlPlane, phase, msg string) (ctrl.Result, error) {
+	if _, err := r.startController(ctx, cp); err != nil && !k8serrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.setRestoreAnnotation(ctx, cp, ""); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	restore.Status.CompletionTime = &now
+
+	return r.setPhase(ctx, restore, phase, msg)
+}
+
+// getRestoredControllerReplicas returns the replicas the Controller is scaled back up to after a restore.
+// An autoscaled Controller restarts from the minimum of its HorizontalPodAutoscaler, which then owns the replicas again:
+// HorizontalPodAutoscalers do not scale Deployments up from zero.
+func getRestoredControllerReplicas(cp *cpv3.ControlPlane) int32 {
+	if scaling := cp.Spec.Autoscaling.Controller; scaling != nil && isExternalDB(&cp.Spec.Database) {
+		if scaling.MinReplicas == 0 {
+			return 1
+		}
+
+		return scaling.MinReplicas
+	}
+
+	if cp.Spec.Replicas.Controller == 0 {
+		return 1
+	}
+
+	return cp.Spec.Replicas.Controller
+}
+
+// startController scales the Controller back up unless it already runs,
+// so that the replicas a HorizontalPodAutoscaler set meanwhile are kept.
+func (r *ControlPlaneRestoreReconciler) startController(ctx context.Context, cp *cpv3.ControlPlane) (*appsv1.Deployment, error) {
+	dep := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: controllerName, Namespace: cp.Namespace}, dep); err != nil {
+		return nil, err
+	}
+
+	if dep.Spec.Replicas == nil || *dep.Spec.Replicas > 0 {
+		return dep, nil
+	}
+
+	patch := client.MergeFrom(dep.DeepCopy())
+	replicas := getRestoredControllerReplicas(cp)
+	dep.Spec.Replicas = &replicas
+
+	return dep, r.Client.Patch(ctx, dep, patch)
+}
+
+func (r *ControlPlaneRestoreReconciler) scaleController(ctx context.Context, cp *cpv3.ControlPlane, replicas int32) (bool, error) {
+	return scaleDeployment(ctx, r.Client, cp.Namespace, controllerName, replicas)
+}
+
+func (r *ControlPlaneRestoreReconciler) setRestoreAnnotation(ctx context.Context, cp *cpv3.ControlPlane, restoreName string) error {
+	patch := client.MergeFrom(cp.DeepCopy())
+
+	if restoreName == "" {
+		if !cp.IsRestoring() {
+			return nil
+		}
+
+		delete(cp.Annotations, cpv3.RestoreInProgressAnnotation)
+	} else {
+		if cp.Annotations == nil {
+			cp.Annotations = map[string]string{}
+		}
+
+		cp.Annotations[cpv3.RestoreInProgressAnnotation] = restoreName
+	}
+
+	return r.Client.Patch(ctx, cp, patch)
+}
+
+func (r *ControlPlaneRestoreReconciler) requeueWithMessage(ctx context.Context, restore *cpv3.ControlPlaneRestore, msg string) (ctrl.Result, error) {
+	if restore.Status.Message != msg {
+		restore.Status.Message = msg
+		if err := r.Status().Update(ctx, restore); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{RequeueAfter: restorePollDelay}, nil
+}
+
+func (r *ControlPlaneRestoreReconciler) setPhase(ctx context.Context, restore *cpv3.ControlPlaneRestore, phase, msg string) (ctrl.Result, error) {
+	r.Log.Info(fmt.Sprintf("ControlPlaneRestore %s phase %s -> %s %s", restore.Name, restore.Status.Phase, phase, msg))
+
+	restore.Status.Phase = phase
+	restore.Status.Message = msg
+
+	if err := r.Status().Update(ctx, restore); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if restore.IsFinished() {
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// createRestoreFromAnnotation turns the restore-from annotation of the ControlPlane into a ControlPlaneRestore.
+// Every request creates a new ControlPlaneRestore, unless one of the same backup is still running.
+func (r *reconcileContext) createRestoreFromAnnotation(ctx context.Context, backup string) error {
+	pending, err := r.hasPendingRestore(ctx, backup)
+	if err != nil {
+		return err
+	}
+
+	if !pending {
+		restore := &cpv3.ControlPlaneRestore{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: r.cp.Name + "-restore-",
+				Namespace:    r.cp.Namespace,
+			},
+			Spec: cpv3.ControlPlaneRestoreSpec{
+				ControlPlane: r.cp.Name,
+				Backup:       backup,
+			},
+		}
+
+		if err := controllerutil.SetControllerReference(r.cp, restore, r.Scheme); err != nil {
+			return err
+		}
+
+		if err := r.Client.Create(ctx, restore); err != nil {
+			return err
+		}
+
+		r.log.Info("Created a new ControlPlaneRestore", "ControlPlaneRestore.Namespace", restore.Namespace, "ControlPlaneRestore.Name", restore.Name)
+	}
+
+	patch := client.MergeFrom(r.cp.DeepCopy())
+	delete(r.cp.Annotations, cpv3.RestoreFromAnnotation)
+
+	return r.Client.Patch(ctx, r.cp, patch)
+}
+
+// hasPendingRestore reports whether a ControlPlaneRestore of backup which has not finished yet exists for the ControlPlane,
+// e.g. when removing the restore-from annotation failed after it was created.
+func (r *reconcileContext) hasPendingRestore(ctx context.Context, backup string) (bool, error) {
+	restores := &cpv3.ControlPlaneRestoreList{}
+	if err := r.Client.List(ctx, restores, client.InNamespace(r.cp.Namespace)); err != nil {
+		return false, err
+	}
+
+	for idx := range restores.Items {
+		restore := &restores.Items[idx]
+		if restore.Spec.ControlPlane == r.cp.Name && restore.Spec.Backup == backup && !restore.IsFinished() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
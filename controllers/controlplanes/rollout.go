@@ -0,0 +1,142 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Reasons of the rollout of a Deployment, as reported in the availability condition of its component.
+const (
+	rolloutReasonComplete                 = "RolloutComplete"
+	rolloutReasonRollingOut               = "RollingOut"
+	rolloutReasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+	rolloutReasonReplicaFailure           = "ReplicaFailure"
+)
+
+var errRolloutFailed = errors.New("deployment rollout failed")
+
+// componentConditions maps each component to the condition reporting the availability of its Deployment.
+var componentConditions = map[string]string{
+	routerName:                cpv3.ConditionRouterAvailable,
+	controllerName:            cpv3.ConditionControllerAvailable,
+	portManagerDeploymentName: cpv3.ConditionPortManagerAvailable,
+}
+
+func getDeploymentCondition(dep *appsv1.Deployment, conditionType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for idx := range dep.Status.Conditions {
+		if dep.Status.Conditions[idx].Type == conditionType {
+			return &dep.Status.Conditions[idx]
+		}
+	}
+
+	return nil
+}
+
+// getDeploymentRollout reports the progress of the rollout of dep, following the checks of kubectl rollout status.
+func getDeploymentRollout(dep *appsv1.Deployment) (rollout *cpv3.DeploymentRolloutStatus, msg string) {
+	rollout = &cpv3.DeploymentRolloutStatus{
+		Replicas:          dep.Status.Replicas,
+		UpdatedReplicas:   dep.Status.UpdatedReplicas,
+		ReadyReplicas:     dep.Status.ReadyReplicas,
+		AvailableReplicas: dep.Status.AvailableReplicas,
+		Reason:            rolloutReasonRollingOut,
+	}
+
+	desired := int32(1)
+	if dep.Spec.Replicas != nil {
+		desired = *dep.Spec.Replicas
+	}
+
+	if condition := getDeploymentCondition(dep, appsv1.DeploymentReplicaFailure); condition != nil && condition.Status == corev1.ConditionTrue {
+		rollout.Reason = rolloutReasonReplicaFailure
+
+		return rollout, fmt.Sprintf("Deployment %s failed to create replicas: %s", dep.Name, condition.Message)
+	}
+
+	if condition := getDeploymentCondition(dep, appsv1.DeploymentProgressing); condition != nil && condition.Reason == rolloutReasonProgressDeadlineExceeded {
+		rollout.Reason = rolloutReasonProgressDeadlineExceeded
+
+		return rollout, fmt.Sprintf("Deployment %s exceeded its progress deadline: %s", dep.Name, condition.Message)
+	}
+
+	switch {
+	case dep.Generation > dep.Status.ObservedGeneration:
+		return rollout, fmt.Sprintf("Waiting for Deployment %s spec update to be observed", dep.Name)
+	case dep.Status.UpdatedReplicas < desired:
+		return rollout, fmt.Sprintf("Waiting for Deployment %s rollout: %d of %d new replicas have been updated", dep.Name, dep.Status.UpdatedReplicas, desired)
+	case dep.Status.Replicas > dep.Status.UpdatedReplicas:
+		return rollout, fmt.Sprintf("Waiting for Deployment %s rollout: %d old replicas are pending termination", dep.Name, dep.Status.Replicas-dep.Status.UpdatedReplicas)
+	case dep.Status.AvailableReplicas < dep.Status.UpdatedReplicas:
+		return rollout, fmt.Sprintf("Waiting for Deployment %s rollout: %d of %d updated replicas are available", dep.Name, dep.Status.AvailableReplicas, dep.Status.UpdatedReplicas)
+	}
+
+	rollout.Reason = rolloutReasonComplete
+
+	return rollout, ""
+}
+
+// isDeploymentRolledOut is the readiness check of the components deployed as a single Deployment.
+// Replica failures and exceeded progress deadlines fail the component rather than keep it waiting.
+func (r *reconcileContext) isDeploymentRolledOut(name string) readyFunc {
+	return func(ctx context.Context, status *cpv3.ComponentStatus) (bool, string, error) {
+		dep := &appsv1.Deployment{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: r.cp.Namespace}, dep); err != nil {
+			return false, "", err
+		}
+
+		rollout, msg := getDeploymentRollout(dep)
+		status.Rollout = rollout
+
+		switch rollout.Reason {
+		case rolloutReasonComplete:
+			return true, "", nil
+		case rolloutReasonRollingOut:
+			return false, msg, nil
+		default:
+			return false, "", fmt.Errorf("%w: %s", errRolloutFailed, msg)
+		}
+	}
+}
+
+// setRolloutConditions reports the rollout of the Deployment of each component which was checked.
+func (r *reconcileContext) setRolloutConditions() {
+	for idx := range r.cp.Status.Components {
+		component := &r.cp.Status.Components[idx]
+
+		conditionType, found := componentConditions[component.Name]
+		if !found || component.Rollout == nil {
+			continue
+		}
+
+		if component.Rollout.Reason == rolloutReasonComplete {
+			r.cp.SetCondition(conditionType, metav1.ConditionTrue, rolloutReasonComplete, "")
+
+			continue
+		}
+
+		r.cp.SetCondition(conditionType, metav1.ConditionFalse, component.Rollout.Reason, component.Message)
+	}
+}
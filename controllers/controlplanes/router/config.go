@@ -5,8 +5,16 @@ import (
 	"strings"
 )
 
-func GetConfig() string {
-	replacer := strings.NewReplacer("<MESSAGE_PORT>", strconv.Itoa(MessagePort),
+// GetConfig returns the configuration of a Router listening on all the addresses of its pod.
+// Pods with an IPv6 address listen on ::, which also accepts IPv4 connections.
+func GetConfig(ipv6 bool) string {
+	listenHost := "0.0.0.0"
+	if ipv6 {
+		listenHost = "::"
+	}
+
+	replacer := strings.NewReplacer("<LISTEN_HOST>", listenHost,
+		"<MESSAGE_PORT>", strconv.Itoa(MessagePort),
 		"<HTTP_PORT>", strconv.Itoa(HTTPPort),
 		"<INTERIOR_PORT>", strconv.Itoa(InteriorPort),
 		"<EDGE_PORT>", strconv.Itoa(EdgePort))
@@ -28,7 +36,7 @@ router {
 }
 
 listener {
-    host: 0.0.0.0
+    host: <LISTEN_HOST>
     port: <MESSAGE_PORT>
     role: normal
 }
@@ -41,7 +49,7 @@ sslProfile {
 }
 
 listener {
-    host: 0.0.0.0
+    host: <LISTEN_HOST>
     port: <HTTP_PORT>
     role: normal
     http: true
@@ -60,7 +68,7 @@ sslProfile {
 
 listener {
     role: inter-router
-    host: 0.0.0.0
+    host: <LISTEN_HOST>
     port: <INTERIOR_PORT>
     saslMechanisms: ANONYMOUS
     authenticatePeer: no
@@ -68,7 +76,7 @@ listener {
 
 listener {
     role: edge
-    host: 0.0.0.0
+    host: <LISTEN_HOST>
     port: <EDGE_PORT>
     saslMechanisms: ANONYMOUS
     authenticatePeer: no
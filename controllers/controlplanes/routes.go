@@ -0,0 +1,358 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	op "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/k8s/operator"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	controllerAPIPort       = 51121
+	controllerViewerPort    = 80
+	controllerAPIRouteName  = "controller-api"
+	controllerViewRouteName = "controller-viewer"
+	defaultAPIPath          = "/api"
+	defaultViewerPath       = "/"
+)
+
+// Gateway API types are handled as unstructured objects so that clusters without the Gateway API CRDs keep working.
+//
+//nolint:gochecknoglobals
+var (
+	httpRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1beta1", Kind: "HTTPRoute"}
+	tcpRouteGVK  = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1alpha2", Kind: "TCPRoute"}
+)
+
+type controllerRoute struct {
+	name  string
+	port  int
+	route cpv3.Route
+}
+
+func getControllerRoutes(ingress *cpv3.ControllerIngress) []controllerRoute {
+	routes := []controllerRoute{
+		{name: controllerAPIRouteName, port: controllerAPIPort, route: ingress.API},
+		{name: controllerViewRouteName, port: controllerViewerPort, route: ingress.Viewer},
+	}
+
+	if routes[0].route.Path == "" {
+		routes[0].route.Path = defaultAPIPath
+	}
+
+	if routes[1].route.Path == "" {
+		routes[1].route.Path = defaultViewerPath
+	}
+
+	return routes
+}
+
+// getEcnViewerURL derives the ECN Viewer URL from its route when it is not configured explicitly.
+func getEcnViewerURL(cp *cpv3.ControlPlane) string {
+	ingress := &cp.Spec.Ingresses.Controller
+	if cp.Spec.Controller.EcnViewerURL != "" || ingress.Kind == "" || ingress.Viewer.Host == "" {
+		return cp.Spec.Controller.EcnViewerURL
+	}
+
+	viewer := getControllerRoutes(ingress)[1].route
+	if viewer.Protocol == cpv3.RouteProtocolTCP {
+		return cp.Spec.Controller.EcnViewerURL
+	}
+
+	scheme := "http"
+	if viewer.TLSSecretName != "" {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, viewer.Host, viewer.Path)
+}
+
+func newIngress(namespace string, ms *microservice, ingress *cpv3.ControllerIngress) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+	ing := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ms.name,
+			Namespace:   namespace,
+			Labels:      ms.labels,
+			Annotations: ingress.Annotations,
+		},
+	}
+
+	if ingress.IngressClassName != "" {
+		ing.Spec.IngressClassName = &ingress.IngressClassName
+	}
+
+	for _, route := range getControllerRoutes(ingress) {
+		ing.Spec.Rules = append(ing.Spec.Rules, networkingv1.IngressRule{
+			Host: route.route.Host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{
+						{
+							Path:     route.route.Path,
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: ms.services[0].name,
+									Port: networkingv1.ServiceBackendPort{Number: int32(route.port)},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		if route.route.TLSSecretName != "" && route.route.Host != "" {
+			ing.Spec.TLS = append(ing.Spec.TLS, networkingv1.IngressTLS{
+				Hosts:      []string{route.route.Host},
+				SecretName: route.route.TLSSecretName,
+			})
+		}
+	}
+
+	return ing
+}
+
+func newGatewayRoute(namespace string, ms *microservice, ingress *cpv3.ControllerIngress, route *controllerRoute) *unstructured.Unstructured {
+	gatewayNamespace := ingress.Gateway.Namespace
+	if gatewayNamespace == "" {
+		gatewayNamespace = namespace
+	}
+
+	parentRef := map[string]interface{}{
+		"name":      ingress.Gateway.Name,
+		"namespace": gatewayNamespace,
+	}
+	if route.route.SectionName != "" {
+		parentRef["sectionName"] = route.route.SectionName
+	}
+
+	backendRefs := []interface{}{
+		map[string]interface{}{
+			"name": ms.services[0].name,
+			"port": int64(route.port),
+		},
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetName(route.name)
+	obj.SetNamespace(namespace)
+	obj.SetLabels(ms.labels)
+	obj.SetAnnotations(ingress.Annotations)
+
+	spec := map[string]interface{}{
+		"parentRefs": []interface{}{parentRef},
+	}
+
+	if route.route.Protocol == cpv3.RouteProtocolTCP {
+		obj.SetGroupVersionKind(tcpRouteGVK)
+		spec["rules"] = []interface{}{
+			map[string]interface{}{"backendRefs": backendRefs},
+		}
+	} else {
+		obj.SetGroupVersionKind(httpRouteGVK)
+		spec["rules"] = []interface{}{
+			map[string]interface{}{
+				"matches": []interface{}{
+					map[string]interface{}{
+						"path": map[string]interface{}{
+							"type":  "PathPrefix",
+							"value": route.route.Path,
+						},
+					},
+				},
+				"backendRefs": backendRefs,
+			},
+		}
+
+		if route.route.Host != "" {
+			spec["hostnames"] = []interface{}{route.route.Host}
+		}
+	}
+
+	obj.Object["spec"] = spec
+
+	return obj
+}
+
+func validateControllerIngress(ingress *cpv3.ControllerIngress) error {
+	switch ingress.Kind {
+	case "", cpv3.RouteKindIngress:
+	case cpv3.RouteKindGateway:
+		if ingress.Gateway.Name == "" {
+			return fmt.Errorf("controller routes of kind %s require a Gateway name", cpv3.RouteKindGateway)
+		}
+	default:
+		return fmt.Errorf("unsupported controller route kind %s, must be %s or %s", ingress.Kind, cpv3.RouteKindIngress, cpv3.RouteKindGateway)
+	}
+
+	for _, route := range []cpv3.Route{ingress.API, ingress.Viewer} {
+		if ingress.Kind == cpv3.RouteKindGateway && route.TLSSecretName != "" {
+			return fmt.Errorf("controller routes of kind %s do not support a tlsSecretName, configure the certificate on the Gateway listener "+
+				"and set the ecnViewerUrl of the Controller instead", cpv3.RouteKindGateway)
+		}
+
+		if route.Protocol != "" && route.Protocol != cpv3.RouteProtocolHTTP && route.Protocol != cpv3.RouteProtocolTCP {
+			return fmt.Errorf("unsupported controller route protocol %s, must be %s or %s", route.Protocol, cpv3.RouteProtocolHTTP, cpv3.RouteProtocolTCP)
+		}
+	}
+
+	return nil
+}
+
+// reconcileControllerRoutes generates the Ingress or Gateway API routes of the Controller and deletes the ones it generated before
+// which are no longer configured. Routes are tracked in the status, so that objects of the same names it did not create are left alone.
+func (r *reconcileContext) reconcileControllerRoutes(ctx context.Context, ms *microservice) op.Reconciliation {
+	ingress := &r.cp.Spec.Ingresses.Controller
+	if err := validateControllerIngress(ingress); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	generated := []cpv3.GeneratedRoute{}
+
+	switch ingress.Kind {
+	case cpv3.RouteKindIngress:
+		ing := newIngress(r.cp.Namespace, ms, ingress)
+		if err := r.createIngress(ctx, ing); err != nil {
+			return op.ReconcileWithError(err)
+		}
+
+		generated = append(generated, cpv3.GeneratedRoute{
+			APIVersion: networkingv1.SchemeGroupVersion.String(),
+			Kind:       "Ingress",
+			Name:       ing.Name,
+		})
+	case cpv3.RouteKindGateway:
+		routes := getControllerRoutes(ingress)
+		for i := range routes {
+			obj := newGatewayRoute(r.cp.Namespace, ms, ingress, &routes[i])
+			if err := r.createUnstructured(ctx, obj); err != nil {
+				return op.ReconcileWithError(err)
+			}
+
+			generated = append(generated, cpv3.GeneratedRoute{
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Name:       obj.GetName(),
+			})
+		}
+	}
+
+	// Routes switching kind, e.g. between HTTP and TCP, leave the previous ones behind
+	for _, previous := range r.cp.Status.Routes {
+		if containsGeneratedRoute(generated, previous) {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(previous.APIVersion)
+		obj.SetKind(previous.Kind)
+		obj.SetName(previous.Name)
+		obj.SetNamespace(r.cp.Namespace)
+
+		r.log.Info(fmt.Sprintf("Deleting %s %s no longer configured for ControlPlane %s", previous.Kind, previous.Name, r.cp.Name))
+
+		if err := r.deleteResource(ctx, obj); err != nil && !meta.IsNoMatchError(err) {
+			return op.ReconcileWithError(err)
+		}
+	}
+
+	if len(generated) == 0 {
+		generated = nil
+	}
+
+	if !reflect.DeepEqual(generated, r.cp.Status.Routes) {
+		r.cp.Status.Routes = generated
+		if err := r.Status().Update(ctx, r.cp); err != nil {
+			return op.ReconcileWithError(err)
+		}
+	}
+
+	return op.Continue()
+}
+
+func containsGeneratedRoute(routes []cpv3.GeneratedRoute, route cpv3.GeneratedRoute) bool {
+	for i := range routes {
+		if routes[i] == route {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *reconcileContext) createIngress(ctx context.Context, ing *networkingv1.Ingress) error {
+	// Set ControlPlane instance as the owner and controller
+	if err := controllerutil.SetControllerReference(r.cp, ing, r.Scheme); err != nil {
+		return err
+	}
+
+	// Check if this resource already exists
+	found := &networkingv1.Ingress{}
+
+	err := r.Client.Get(ctx, types.NamespacedName{Name: ing.Name, Namespace: ing.Namespace}, found)
+	if err != nil && k8serrors.IsNotFound(err) {
+		r.log.Info("Creating a new Ingress", "Ingress.Namespace", ing.Namespace, "Ingress.Name", ing.Name)
+
+		return r.Client.Create(ctx, ing)
+	} else if err != nil {
+		return err
+	}
+
+	// Resource already exists - update it
+	ing.ResourceVersion = found.ResourceVersion
+
+	return r.Client.Update(ctx, ing)
+}
+
+func (r *reconcileContext) createUnstructured(ctx context.Context, obj *unstructured.Unstructured) error {
+	// Set ControlPlane instance as the owner and controller
+	if err := controllerutil.SetControllerReference(r.cp, obj, r.Scheme); err != nil {
+		return err
+	}
+
+	// Check if this resource already exists
+	found := &unstructured.Unstructured{}
+	found.SetGroupVersionKind(obj.GroupVersionKind())
+
+	err := r.Client.Get(ctx, types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}, found)
+	if err != nil && k8serrors.IsNotFound(err) {
+		r.log.Info(fmt.Sprintf("Creating a new %s", obj.GetKind()), "Namespace", obj.GetNamespace(), "Name", obj.GetName())
+
+		return r.Client.Create(ctx, obj)
+	} else if err != nil {
+		return err
+	}
+
+	// Resource already exists - update it
+	obj.SetResourceVersion(found.GetResourceVersion())
+
+	return r.Client.Update(ctx, obj)
+}
@@ -18,14 +18,30 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 
 	op "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/k8s/operator"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
 )
 
 type reconcileFunc = func(ctx context.Context) op.Reconciliation
 
-func (r *ControlPlaneReconciler) getReconcileFunc(ctx context.Context) (reconcileFunc, error) {
+func (r *reconcileContext) getReconcileFunc(ctx context.Context) (reconcileFunc, error) {
+	if r.cp.IsRestoring() {
+		return r.reconcileRestoring, nil
+	}
+
+	migrate, err := r.needsDatabaseMigration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if migrate {
+		return r.reconcileMigratingDatabase, nil
+	}
+
 	if r.cp.IsReady() {
 		return r.reconcileReady, nil
 	}
@@ -36,82 +52,105 @@ func (r *ControlPlaneReconciler) getReconcileFunc(ctx context.Context) (reconcil
 	// If invalid state, migrate state to deploying to restart on sane basis
 	r.cp.SetConditionDeploying(nil)
 
-	if err := r.Status().Update(ctx, &r.cp); err != nil {
+	if err := r.Status().Update(ctx, r.cp); err != nil {
 		return nil, err
 	}
 
 	return r.reconcileDeploying, nil
 }
 
-func (r *ControlPlaneReconciler) reconcileReady(ctx context.Context) op.Reconciliation {
-	// Do nothing
-	r.log.Info(fmt.Sprintf("reconcileReady() ControlPlane %s", r.cp.Name))
+func (r *reconcileContext) reconcileRestoring(ctx context.Context) op.Reconciliation {
+	// The ControlPlaneRestore reconciler owns the Controller until it removes the annotation
+	r.log.Info(fmt.Sprintf("reconcileRestoring() ControlPlane %s by %s", r.cp.Name, r.cp.Annotations[cpv3.RestoreInProgressAnnotation]))
 
 	return op.Reconcile()
 }
 
-func (r *ControlPlaneReconciler) reconcileDeploying(ctx context.Context) op.Reconciliation {
-	r.log.Info(fmt.Sprintf("reconcileDeploying() ControlPlane %s", r.cp.Name))
+func (r *reconcileContext) reconcileReady(ctx context.Context) op.Reconciliation {
+	r.log.Info(fmt.Sprintf("reconcileReady() ControlPlane %s", r.cp.Name))
 
-	// Error chan for reconcile routines
-	reconcilerCount := 3
-	reconChan := make(chan op.Reconciliation, reconcilerCount)
+	// Storage can be expanded without redeploying the ControlPlane
+	if recon := r.reconcileControllerStorage(ctx); recon.IsFinal() {
+		return recon
+	}
 
-	// Reconcile Router
-	go reconcileRoutine(ctx, r.reconcileRouter, reconChan)
+	ms := r.getControllerMicroservice()
 
-	// Reconcile Iofog Controller and Kubelet
-	go reconcileRoutine(ctx, r.reconcileIofogController, reconChan)
+	if recon := r.reconcileControllerRoutes(ctx, ms); recon.IsFinal() {
+		return recon
+	}
 
-	// Reconcile Port Manager
-	go reconcileRoutine(ctx, r.reconcilePortManager, reconChan)
+	if recon := r.reconcileControllerAutoscaling(ctx, ms); recon.IsFinal() {
+		return recon
+	}
 
-	// Wait for all parallel recons and evaluate results
-	finRecon := op.Reconciliation{}
+	if recon := r.reconcileBackup(ctx); recon.IsFinal() {
+		return recon
+	}
 
-	for i := 0; i < reconcilerCount; i++ {
-		recon := <-reconChan
-		if recon.Err != nil {
-			if finRecon.Err == nil {
-				// Create new err
-				finRecon.Err = recon.Err
-			} else {
-				// Append
-				finRecon.Err = fmt.Errorf("%s\n%s", finRecon.Err.Error(), recon.Err.Error()) //nolint:errorlint
-			}
-		}
-		// End overrides all
-		if recon.End {
-			finRecon.End = true
-		}
-		// Record largest requeue
-		if recon.Requeue {
-			finRecon.Requeue = true
-			if recon.Delay > finRecon.Delay {
-				finRecon.Delay = recon.Delay
-			}
-		}
+	return op.Reconcile()
+}
+
+// getDeployingPhases orders the deployment of the components: the Controller registers the Router address as its default Router,
+// and the Port Manager logs into the Controller with the ControlPlane user.
+func (r *reconcileContext) getDeployingPhases() []phase {
+	return []phase{
+		{
+			name:      routerName,
+			reconcile: r.reconcileRouter,
+			ready:     r.isDeploymentRolledOut(routerName),
+		},
+		{
+			name:      controllerName,
+			dependsOn: []string{routerName},
+			reconcile: r.reconcileIofogController,
+			ready:     r.isDeploymentRolledOut(controllerName),
+		},
+		{
+			name:      portManagerDeploymentName,
+			dependsOn: []string{controllerName},
+			reconcile: r.reconcilePortManager,
+			ready:     r.isDeploymentRolledOut(portManagerDeploymentName),
+		},
 	}
+}
+
+func (r *reconcileContext) reconcileDeploying(ctx context.Context) op.Reconciliation {
+	r.log.Info(fmt.Sprintf("reconcileDeploying() ControlPlane %s", r.cp.Name))
+
+	original := r.cp.Status.DeepCopy()
+	finRecon := r.runPhases(ctx, r.getDeployingPhases())
+	r.setRolloutConditions()
 
 	if finRecon.IsFinal() {
 		r.log.Info(fmt.Sprintf("reconcileDeploying() ControlPlane %s isFinal", r.cp.Name))
 
+		if !reflect.DeepEqual(original, &r.cp.Status) {
+			if err := r.Status().Update(ctx, r.cp); err != nil {
+				return op.ReconcileWithError(errors.Join(finRecon.Err, err))
+			}
+		}
+
 		return finRecon
 	}
 
 	// deploying -> ready
 	if r.cp.IsDeploying() {
+		if _, _, err := r.updateStorageStatus(ctx); err != nil {
+			return op.ReconcileWithError(err)
+		}
+
 		r.log.Info(fmt.Sprintf("reconcileDeploying() ControlPlane %s setReady", r.cp.Name))
 		r.cp.SetConditionReady(&r.log) // temporary logger
 		r.log.Info(fmt.Sprintf("reconcileDeploying() ControlPlane %s -- write status update, new conditions %v", r.cp.Name, r.cp.Status.Conditions))
 
-		if err := r.Status().Update(ctx, &r.cp); err != nil {
+		if err := r.Status().Update(ctx, r.cp); err != nil {
 			r.log.Error(err, fmt.Sprintf("reconcileDeploying() ControlPlane %s -- failed to update status", r.cp.Name))
 
 			return op.ReconcileWithError(err)
 		}
 
-		if err := r.Update(ctx, &r.cp); err != nil {
+		if err := r.Update(ctx, r.cp); err != nil {
 			return op.ReconcileWithError(err)
 		}
 
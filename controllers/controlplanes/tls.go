@@ -0,0 +1,315 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	op "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/k8s/operator"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	"github.com/skupperproject/skupper-cli/pkg/certs"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// Self-signed certificates are reissued by the same CA this long before they expire
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+	certManagerGroup      = "cert-manager.io"
+)
+
+// cert-manager types are handled as unstructured objects so that clusters without cert-manager keep working.
+//
+//nolint:gochecknoglobals
+var certificateGVK = schema.GroupVersionKind{Group: certManagerGroup, Version: "v1", Kind: "Certificate"}
+
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+
+func validateControllerTLS(tls *cpv3.ControllerTLS) error {
+	switch tls.Mode {
+	case cpv3.ControllerTLSModeSelfSigned:
+	case cpv3.ControllerTLSModeCertManager:
+		if tls.IssuerRef == nil || tls.IssuerRef.Name == "" {
+			return fmt.Errorf("controller TLS mode %s requires an issuerRef name", cpv3.ControllerTLSModeCertManager)
+		}
+	case cpv3.ControllerTLSModeSecret:
+		if tls.SecretName == "" {
+			return fmt.Errorf("controller TLS mode %s requires a secretName", cpv3.ControllerTLSModeSecret)
+		}
+	default:
+		return fmt.Errorf("unsupported controller TLS mode %s, must be %s, %s or %s",
+			tls.Mode, cpv3.ControllerTLSModeSelfSigned, cpv3.ControllerTLSModeCertManager, cpv3.ControllerTLSModeSecret)
+	}
+
+	return nil
+}
+
+// reconcileControllerTLS provides the certificate of the Controller, trusts its CA for the ioFog clients of the ControlPlane
+// and mounts it into the Controller microservice.
+func (r *reconcileContext) reconcileControllerTLS(ctx context.Context, ms *microservice) op.Reconciliation {
+	tls := r.cp.Spec.Controller.TLS
+	secretName := r.cp.Spec.Controller.GetTLSSecretName()
+
+	if !r.cp.Spec.Controller.IsTLSEnabled() || tls.Mode != cpv3.ControllerTLSModeCertManager {
+		if err := r.deleteCertificate(ctx, secretName); err != nil {
+			return op.ReconcileWithError(err)
+		}
+	}
+
+	if !r.cp.Spec.Controller.IsTLSEnabled() {
+		return op.Continue()
+	}
+
+	if err := validateControllerTLS(tls); err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	hosts, err := r.getControllerHosts(ctx)
+	if err != nil {
+		return op.ReconcileWithError(err)
+	}
+
+	switch tls.Mode {
+	case cpv3.ControllerTLSModeSelfSigned:
+		if err := r.reconcileSelfSignedControllerTLS(ctx, secretName, hosts); err != nil {
+			return op.ReconcileWithError(err)
+		}
+	case cpv3.ControllerTLSModeCertManager:
+		if err := r.createUnstructured(ctx, newCertificate(r.cp.Namespace, secretName, tls.IssuerRef, hosts)); err != nil {
+			if meta.IsNoMatchError(err) {
+				return op.ReconcileWithError(fmt.Errorf("controller TLS mode %s requires cert-manager: %w", cpv3.ControllerTLSModeCertManager, err))
+			}
+
+			return op.ReconcileWithError(err)
+		}
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: secretName, Namespace: r.cp.Namespace}, secret); err != nil {
+		if k8serrors.IsNotFound(err) && tls.Mode == cpv3.ControllerTLSModeCertManager {
+			r.log.Info(fmt.Sprintf("Waiting for cert-manager to issue secret %s for ControlPlane %s", secretName, r.cp.Name))
+
+			return op.ReconcileWithRequeue(time.Second * 5) //nolint:gomnd
+		}
+
+		return op.ReconcileWithError(err)
+	}
+
+	for _, key := range []string{iofog.TLSCertSecretKey, iofog.TLSKeySecretKey} {
+		if len(secret.Data[key]) == 0 {
+			return op.ReconcileWithError(fmt.Errorf("controller TLS secret %s has no %s key", secretName, key))
+		}
+	}
+
+	caKey := iofog.GetCAKey(secret)
+
+	r.controllerCA = secret.Data[caKey]
+
+	checksum := sha256.Sum256(secret.Data[iofog.TLSCertSecretKey])
+	setControllerTLS(ms, secretName, caKey, hex.EncodeToString(checksum[:]))
+
+	return op.Continue()
+}
+
+// getControllerHosts lists the addresses and names the Controller API is reached on, for the SANs of its certificate.
+// Addresses of a LoadBalancer are only known once it is provisioned, the certificate is then reissued.
+func (r *reconcileContext) getControllerHosts(ctx context.Context) ([]string, error) {
+	hosts := []string{
+		controllerName,
+		fmt.Sprintf("%s.%s", controllerName, r.cp.Namespace),
+		fmt.Sprintf("%s.%s.svc", controllerName, r.cp.Namespace),
+		iofog.GetServiceHost(controllerName, r.cp.Namespace),
+		r.cp.Spec.Services.Controller.Address,
+	}
+	hosts = append(hosts, r.cp.Spec.Controller.TLS.Hosts...)
+
+	svc := &corev1.Service{}
+
+	err := r.Client.Get(ctx, types.NamespacedName{Name: controllerName, Namespace: r.cp.Namespace}, svc)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		hosts = append(hosts, getLoadBalancerAddresses(svc)...)
+		hosts = append(hosts, svc.Spec.ClusterIPs...)
+	}
+
+	unique := []string{}
+	seen := map[string]bool{}
+
+	for _, host := range hosts {
+		if host == "" || host == corev1.ClusterIPNone || seen[host] {
+			continue
+		}
+
+		seen[host] = true
+		unique = append(unique, host)
+	}
+
+	return unique, nil
+}
+
+// reconcileSelfSignedControllerTLS keeps a CA for the ControlPlane and reissues the certificate of the Controller
+// when it does not cover hosts, was signed by another CA or is about to expire.
+func (r *reconcileContext) reconcileSelfSignedControllerTLS(ctx context.Context, secretName string, hosts []string) (err error) {
+	defer func() {
+		if recoverResult := recover(); recoverResult != nil {
+			err = fmt.Errorf("generate controller TLS secret %s failed: %v", secretName, recoverResult)
+		}
+	}()
+
+	caName := secretName + "-ca"
+	caSecret := &corev1.Secret{}
+
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: caName, Namespace: r.cp.Namespace}, caSecret); err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return err
+		}
+
+		r.log.Info(fmt.Sprintf("Generating controller CA secret %s for ControlPlane %s", caName, r.cp.Name))
+
+		*caSecret = certs.GenerateCASecret(caName, caName)
+		if err := r.createOwnedSecret(ctx, caSecret); err != nil {
+			return err
+		}
+	}
+
+	secret := &corev1.Secret{}
+
+	err = r.Client.Get(ctx, types.NamespacedName{Name: secretName, Namespace: r.cp.Namespace}, secret)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	found := err == nil
+	if found && bytes.Equal(secret.Data[iofog.CACertSecretKey], caSecret.Data[iofog.TLSCertSecretKey]) && isCertificateValidFor(secret.Data[iofog.TLSCertSecretKey], hosts) {
+		return nil
+	}
+
+	r.log.Info(fmt.Sprintf("Generating controller TLS secret %s for %s for ControlPlane %s", secretName, strings.Join(hosts, ","), r.cp.Name))
+
+	generated := certs.GenerateSecret(secretName, hosts[0], strings.Join(hosts, ","), caSecret)
+	if !found {
+		return r.createOwnedSecret(ctx, &generated)
+	}
+
+	secret.Type = generated.Type
+	secret.Data = generated.Data
+
+	return r.Client.Update(ctx, secret)
+}
+
+// isCertificateValidFor reports whether the PEM encoded certificate covers every host and does not expire soon.
+func isCertificateValidFor(certPEM []byte, hosts []string) bool {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return false
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil || time.Now().Add(selfSignedRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+
+	for _, host := range hosts {
+		if err := cert.VerifyHostname(host); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *reconcileContext) createOwnedSecret(ctx context.Context, secret *corev1.Secret) error {
+	secret.Namespace = r.cp.Namespace
+
+	if err := controllerutil.SetControllerReference(r.cp, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	return r.Client.Create(ctx, secret)
+}
+
+func newCertificate(namespace, secretName string, issuer *cpv3.CertManagerIssuerReference, hosts []string) *unstructured.Unstructured {
+	dnsNames := []interface{}{}
+	ipAddresses := []interface{}{}
+
+	for _, host := range hosts {
+		if net.ParseIP(host) != nil {
+			ipAddresses = append(ipAddresses, host)
+		} else {
+			dnsNames = append(dnsNames, host)
+		}
+	}
+
+	issuerRef := map[string]interface{}{
+		"name":  issuer.Name,
+		"kind":  "Issuer",
+		"group": certManagerGroup,
+	}
+
+	if issuer.Kind != "" {
+		issuerRef["kind"] = issuer.Kind
+	}
+
+	if issuer.Group != "" {
+		issuerRef["group"] = issuer.Group
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(certificateGVK)
+	obj.SetName(secretName)
+	obj.SetNamespace(namespace)
+	obj.Object["spec"] = map[string]interface{}{
+		"secretName":  secretName,
+		"commonName":  hosts[0],
+		"dnsNames":    dnsNames,
+		"ipAddresses": ipAddresses,
+		"issuerRef":   issuerRef,
+	}
+
+	return obj
+}
+
+func (r *reconcileContext) deleteCertificate(ctx context.Context, name string) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(certificateGVK)
+	obj.SetName(name)
+	obj.SetNamespace(r.cp.Namespace)
+
+	if err := r.deleteResource(ctx, obj); err != nil && !meta.IsNoMatchError(err) {
+		return err
+	}
+
+	return nil
+}
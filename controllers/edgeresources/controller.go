@@ -0,0 +1,194 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"reflect"
+	"time"
+
+	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	edgeResourceFinalizer = "iofog.org/edgeresource"
+	controlPlaneWaitDelay = 10 * time.Second
+)
+
+// EdgeResourceReconciler reconciles a EdgeResource object.
+type EdgeResourceReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=iofog.org,resources=edgeresources,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=iofog.org,resources=edgeresources/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=iofog.org,resources=controlplanes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+
+func (r *EdgeResourceReconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("edgeresource", request.NamespacedName)
+
+	instance := &appsv3.EdgeResource{}
+
+	err := r.Client.Get(ctx, request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	controller, err := iofog.GetController(ctx, r.Client, instance.Namespace, instance.Spec.ControlPlaneRef)
+
+	var clt *iofogclient.Client
+	if err == nil {
+		clt, err = iofog.NewClient(controller)
+	}
+
+	// Remove the edge resource from the ioFog Controller before the EdgeResource is deleted
+	if !instance.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(instance, edgeResourceFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		// Without a ControlPlane there is no ioFog Controller left to clean up
+		if goerrors.Is(err, iofog.ErrControlPlaneNotReady) {
+			return ctrl.Result{RequeueAfter: controlPlaneWaitDelay}, nil
+		} else if err != nil && !goerrors.Is(err, iofog.ErrControlPlaneNotFound) {
+			return ctrl.Result{}, err
+		}
+
+		if err == nil {
+			log.Info("Deleting edge resource from ioFog Controller")
+
+			if err := deleteEdgeResource(clt, instance); err != nil {
+				log.Error(err, "Failed to delete edge resource from ioFog Controller")
+
+				return ctrl.Result{}, err
+			}
+		}
+
+		controllerutil.RemoveFinalizer(instance, edgeResourceFinalizer)
+
+		return ctrl.Result{}, r.Client.Update(ctx, instance)
+	}
+
+	original := instance.Status.DeepCopy()
+
+	if err != nil {
+		log.Info("Waiting for ControlPlane", "reason", err.Error())
+		instance.SetCondition(appsv3.ConditionControlPlaneReady, metav1.ConditionFalse, iofog.GetControlPlaneReason(err), err.Error())
+
+		return ctrl.Result{RequeueAfter: controlPlaneWaitDelay}, r.updateStatus(ctx, instance, original)
+	}
+
+	instance.SetCondition(appsv3.ConditionControlPlaneReady, metav1.ConditionTrue, "ControlPlaneReady", "")
+
+	if !controllerutil.ContainsFinalizer(instance, edgeResourceFinalizer) {
+		controllerutil.AddFinalizer(instance, edgeResourceFinalizer)
+
+		if err := r.Client.Update(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := syncEdgeResource(clt, instance); err != nil {
+		log.Error(err, "Failed to synchronize edge resource with ioFog Controller")
+		reason := "SyncFailed"
+		if goerrors.Is(err, errInvalidSpec) {
+			reason = "InvalidSpec"
+		}
+
+		instance.SetCondition(appsv3.ConditionSynced, metav1.ConditionFalse, reason, err.Error())
+
+		if statusErr := r.updateStatus(ctx, instance, original); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	instance.Status.ObservedGeneration = instance.Generation
+	instance.SetCondition(appsv3.ConditionSynced, metav1.ConditionTrue, "Synced", "")
+
+	return ctrl.Result{}, r.updateStatus(ctx, instance, original)
+}
+
+func (r *EdgeResourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&appsv3.EdgeResource{}).
+		Watches(&source.Kind{Type: &cpv3.ControlPlane{}}, handler.EnqueueRequestsFromMapFunc(r.getControlPlaneEdgeResources)).
+		Complete(r)
+}
+
+// getControlPlaneEdgeResources requeues the EdgeResources defined in a ControlPlane, so that they resume once it is ready.
+func (r *EdgeResourceReconciler) getControlPlaneEdgeResources(obj client.Object) []reconcile.Request {
+	resources := &appsv3.EdgeResourceList{}
+	if err := r.Client.List(context.Background(), resources); err != nil {
+		r.Log.Error(err, "Failed to list edge resources", "ControlPlane.Namespace", obj.GetNamespace(), "ControlPlane.Name", obj.GetName())
+
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+
+	for idx := range resources.Items {
+		resource := &resources.Items[idx]
+		if !iofog.ReferencesControlPlane(resource.Namespace, resource.Spec.ControlPlaneRef, obj) {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: resource.Name, Namespace: resource.Namespace},
+		})
+	}
+
+	return requests
+}
+
+// updateStatus writes the status subresource when it differs from original.
+func (r *EdgeResourceReconciler) updateStatus(ctx context.Context, resource *appsv3.EdgeResource, original *appsv3.EdgeResourceStatus) error {
+	if reflect.DeepEqual(original, &resource.Status) {
+		return nil
+	}
+
+	if err := r.Status().Update(ctx, resource); err != nil {
+		r.Log.Error(err, "Failed to update edge resource status", "EdgeResource.Namespace", resource.Namespace, "EdgeResource.Name", resource.Name)
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+)
+
+var errInvalidSpec = errors.New("invalid edge resource")
+
+func newEdgeResourceMetadata(resource *appsv3.EdgeResource) (*iofogclient.EdgeResourceMetadata, error) {
+	metadata := &iofogclient.EdgeResourceMetadata{
+		Name:              iofog.GetIofogName(resource.Namespace, resource.Spec.ControlPlaneRef, resource.Name),
+		Description:       resource.Spec.Description,
+		Version:           resource.Spec.Version,
+		InterfaceProtocol: resource.Spec.InterfaceProtocol,
+		OrchestrationTags: resource.Spec.OrchestrationTags,
+	}
+
+	if metadata.InterfaceProtocol == "" {
+		metadata.InterfaceProtocol = appsv3.EdgeResourceProtocolHTTPS
+	}
+
+	if display := resource.Spec.Display; display != nil {
+		metadata.Display = &iofogclient.EdgeResourceDisplay{
+			Name:  display.Name,
+			Icon:  display.Icon,
+			Color: display.Color,
+		}
+	}
+
+	if resource.Spec.Interface != nil {
+		endpoints := make([]iofogclient.HTTPEndpoint, len(resource.Spec.Interface.Endpoints))
+		for idx, endpoint := range resource.Spec.Interface.Endpoints {
+			endpoints[idx] = iofogclient.HTTPEndpoint(endpoint)
+		}
+
+		metadata.Interface = iofogclient.HTTPEdgeResource{Endpoints: endpoints}
+	}
+
+	if resource.Spec.Custom != nil && len(resource.Spec.Custom.Raw) > 0 {
+		if err := json.Unmarshal(resource.Spec.Custom.Raw, &metadata.Custom); err != nil {
+			return nil, fmt.Errorf("%w: custom metadata of %s must be an object: %s", errInvalidSpec, resource.Name, err.Error())
+		}
+	}
+
+	return metadata, nil
+}
+
+// syncEdgeResource creates the edge resource in the ioFog Controller, or updates it when its spec changed.
+// Changing the version creates the new version before deleting the previous one.
+func syncEdgeResource(clt *iofogclient.Client, resource *appsv3.EdgeResource) error {
+	metadata, err := newEdgeResourceMetadata(resource)
+	if err != nil {
+		return err
+	}
+
+	_, err = clt.GetHTTPEdgeResourceByName(metadata.Name, metadata.Version)
+
+	switch {
+	case iofog.IsNotFound(err):
+		err = clt.CreateHTTPEdgeResource(*metadata)
+	case err == nil && resource.Status.ObservedGeneration != resource.Generation:
+		err = clt.UpdateHTTPEdgeResource(metadata.Name, metadata)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if resource.Status.Version != "" && resource.Status.Version != metadata.Version {
+		if err := deleteEdgeResource(clt, resource); err != nil {
+			return err
+		}
+	}
+
+	resource.Status.Name = metadata.Name
+	resource.Status.Version = metadata.Version
+
+	return nil
+}
+
+func deleteEdgeResource(clt *iofogclient.Client, resource *appsv3.EdgeResource) error {
+	if resource.Status.Version == "" {
+		return nil
+	}
+
+	if err := clt.DeleteEdgeResource(resource.Status.Name, resource.Status.Version); err != nil && !iofog.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"reflect"
+	"time"
+
+	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	registryFinalizer     = "iofog.org/registry"
+	controlPlaneWaitDelay = 10 * time.Second
+)
+
+// RegistryReconciler reconciles a Registry object.
+type RegistryReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=iofog.org,resources=registries,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=iofog.org,resources=registries/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=iofog.org,resources=controlplanes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+
+func (r *RegistryReconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("registry", request.NamespacedName)
+
+	instance := &appsv3.Registry{}
+
+	err := r.Client.Get(ctx, request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	controller, err := iofog.GetController(ctx, r.Client, instance.Namespace, instance.Spec.ControlPlaneRef)
+
+	var clt *iofogclient.Client
+	if err == nil {
+		clt, err = iofog.NewClient(controller)
+	}
+
+	// Remove the registry from the ioFog Controller before the Registry is deleted
+	if !instance.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(instance, registryFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		// Without a ControlPlane there is no ioFog Controller left to clean up
+		if goerrors.Is(err, iofog.ErrControlPlaneNotReady) {
+			return ctrl.Result{RequeueAfter: controlPlaneWaitDelay}, nil
+		} else if err != nil && !goerrors.Is(err, iofog.ErrControlPlaneNotFound) {
+			return ctrl.Result{}, err
+		}
+
+		if err == nil {
+			log.Info("Deleting registry from ioFog Controller")
+
+			if err := deleteRegistry(clt, instance); err != nil {
+				log.Error(err, "Failed to delete registry from ioFog Controller")
+
+				return ctrl.Result{}, err
+			}
+		}
+
+		controllerutil.RemoveFinalizer(instance, registryFinalizer)
+
+		return ctrl.Result{}, r.Client.Update(ctx, instance)
+	}
+
+	original := instance.Status.DeepCopy()
+
+	if err != nil {
+		log.Info("Waiting for ControlPlane", "reason", err.Error())
+		instance.SetCondition(appsv3.ConditionControlPlaneReady, metav1.ConditionFalse, iofog.GetControlPlaneReason(err), err.Error())
+
+		return ctrl.Result{RequeueAfter: controlPlaneWaitDelay}, r.updateStatus(ctx, instance, original)
+	}
+
+	instance.SetCondition(appsv3.ConditionControlPlaneReady, metav1.ConditionTrue, "ControlPlaneReady", "")
+
+	if !controllerutil.ContainsFinalizer(instance, registryFinalizer) {
+		controllerutil.AddFinalizer(instance, registryFinalizer)
+
+		if err := r.Client.Update(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	creds, reason, err := r.getCredentials(ctx, instance)
+	if err == nil {
+		reason = "SyncFailed"
+		err = syncRegistry(clt, instance, &creds, []byte(controller.Password))
+	}
+
+	if goerrors.Is(err, errRegistryConflict) {
+		reason = "Conflict"
+	}
+
+	if err != nil {
+		log.Error(err, "Failed to synchronize registry with ioFog Controller")
+		instance.SetCondition(appsv3.ConditionSynced, metav1.ConditionFalse, reason, err.Error())
+
+		if statusErr := r.updateStatus(ctx, instance, original); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	instance.Status.ObservedGeneration = instance.Generation
+	instance.SetCondition(appsv3.ConditionSynced, metav1.ConditionTrue, "Synced", "")
+
+	return ctrl.Result{}, r.updateStatus(ctx, instance, original)
+}
+
+// getCredentials returns the credentials of the registry, and the reason of the Synced condition when they are unavailable.
+func (r *RegistryReconciler) getCredentials(ctx context.Context, registry *appsv3.Registry) (registryCredentials, string, error) {
+	if registry.Spec.SecretName == "" {
+		return registryCredentials{
+			url:    normalizeRegistryURL(registry.Spec.URL),
+			public: registry.Spec.Public,
+		}, "", nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: registry.Spec.SecretName, Namespace: registry.Namespace}, secret); err != nil {
+		return registryCredentials{}, "SecretNotFound", err
+	}
+
+	creds, err := getCredentials(registry, secret)
+	if err != nil {
+		return registryCredentials{}, "InvalidSecret", err
+	}
+
+	creds.public = registry.Spec.Public
+
+	return creds, "", nil
+}
+
+func (r *RegistryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&appsv3.Registry{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.getSecretRegistries)).
+		Watches(&source.Kind{Type: &cpv3.ControlPlane{}}, handler.EnqueueRequestsFromMapFunc(r.getControlPlaneRegistries)).
+		Complete(r)
+}
+
+// getSecretRegistries requeues the Registries using a Secret, so that rotated credentials reach the ioFog Controller.
+func (r *RegistryReconciler) getSecretRegistries(obj client.Object) []reconcile.Request {
+	registries := &appsv3.RegistryList{}
+	if err := r.Client.List(context.Background(), registries, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "Failed to list registries", "Secret.Namespace", obj.GetNamespace(), "Secret.Name", obj.GetName())
+
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+
+	for idx := range registries.Items {
+		registry := &registries.Items[idx]
+		if registry.Spec.SecretName != obj.GetName() {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: registry.Name, Namespace: registry.Namespace},
+		})
+	}
+
+	return requests
+}
+
+// getControlPlaneRegistries requeues the Registries configured in a ControlPlane, so that they resume once it is ready.
+func (r *RegistryReconciler) getControlPlaneRegistries(obj client.Object) []reconcile.Request {
+	registries := &appsv3.RegistryList{}
+	if err := r.Client.List(context.Background(), registries); err != nil {
+		r.Log.Error(err, "Failed to list registries", "ControlPlane.Namespace", obj.GetNamespace(), "ControlPlane.Name", obj.GetName())
+
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+
+	for idx := range registries.Items {
+		registry := &registries.Items[idx]
+		if !iofog.ReferencesControlPlane(registry.Namespace, registry.Spec.ControlPlaneRef, obj) {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: registry.Name, Namespace: registry.Namespace},
+		})
+	}
+
+	return requests
+}
+
+// updateStatus writes the status subresource when it differs from original.
+func (r *RegistryReconciler) updateStatus(ctx context.Context, registry *appsv3.Registry, original *appsv3.RegistryStatus) error {
+	if reflect.DeepEqual(original, &registry.Status) {
+		return nil
+	}
+
+	if err := r.Status().Update(ctx, registry); err != nil {
+		r.Log.Error(err, "Failed to update registry status", "Registry.Namespace", registry.Namespace, "Registry.Name", registry.Name)
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The ioFog Controller comes with registry.hub.docker.com and the cache of the Agents, which must never be deleted
+const lastBuiltinRegistryID = 2
+
+var (
+	errInvalidSecret    = errors.New("invalid registry Secret")
+	errRegistryConflict = errors.New("registry already exists in the ioFog Controller")
+)
+
+type registryCredentials struct {
+	url      string
+	username string
+	password string
+	email    string
+	public   bool
+}
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+type dockerConfigEntry struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// normalizeRegistryURL strips what Docker adds around registry hosts, e.g. https://index.docker.io/v1/.
+func normalizeRegistryURL(url string) string {
+	url = strings.TrimPrefix(url, "https://")
+	url = strings.TrimPrefix(url, "http://")
+	url = strings.TrimSuffix(url, "/")
+
+	return strings.TrimSuffix(url, "/v1")
+}
+
+// getCredentials reads the credentials of the registry from a kubernetes.io/dockerconfigjson Secret.
+func getCredentials(registry *appsv3.Registry, secret *corev1.Secret) (registryCredentials, error) {
+	if secret.Type != corev1.SecretTypeDockerConfigJson {
+		return registryCredentials{}, fmt.Errorf("%w: %s is of type %s, expected %s", errInvalidSecret, secret.Name, secret.Type, corev1.SecretTypeDockerConfigJson)
+	}
+
+	config := dockerConfigJSON{}
+	if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		return registryCredentials{}, fmt.Errorf("%w: %s: %s", errInvalidSecret, secret.Name, err.Error())
+	}
+
+	url := normalizeRegistryURL(registry.Spec.URL)
+	if url == "" && len(config.Auths) != 1 {
+		return registryCredentials{}, fmt.Errorf("%w: %s holds %d registries, set spec.url to select one", errInvalidSecret, secret.Name, len(config.Auths))
+	}
+
+	for server, entry := range config.Auths {
+		if url != "" && normalizeRegistryURL(server) != url {
+			continue
+		}
+
+		creds := registryCredentials{
+			url:      normalizeRegistryURL(server),
+			username: entry.Username,
+			password: entry.Password,
+			email:    entry.Email,
+		}
+
+		// Credentials are often only stored as base64 encoded username:password
+		if entry.Auth != "" && creds.username == "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return registryCredentials{}, fmt.Errorf("%w: auth of %s in %s is not a valid base64 string", errInvalidSecret, server, secret.Name)
+			}
+
+			creds.username, creds.password, _ = strings.Cut(string(decoded), ":")
+		}
+
+		return creds, nil
+	}
+
+	return registryCredentials{}, fmt.Errorf("%w: %s has no credentials for %s", errInvalidSecret, secret.Name, url)
+}
+
+// hash keys the credentials with key, so that the status does not expose a password that can be brute-forced.
+func (creds *registryCredentials) hash(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(fmt.Sprintf("%s\n%s\n%s\n%s\n%t", creds.url, creds.username, creds.password, creds.email, creds.public)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func isBuiltinRegistry(id int) bool {
+	return id <= lastBuiltinRegistryID
+}
+
+// findRegistry returns the registry with the ID recorded in the status, or nil when the Registry did not create one yet.
+// Registries with the same URL that the Registry did not create are reported as a conflict rather than adopted.
+func findRegistry(clt *iofogclient.Client, registry *appsv3.Registry, url string) (*iofogclient.RegistryInfo, error) {
+	response, err := clt.ListRegistries()
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range response.Registries {
+		info := &response.Registries[idx]
+		if registry.Status.ID != 0 && int64(info.ID) == registry.Status.ID {
+			return info, nil
+		}
+	}
+
+	for idx := range response.Registries {
+		info := &response.Registries[idx]
+		if normalizeRegistryURL(info.URL) == url {
+			return nil, fmt.Errorf("%w: %s has ID %d", errRegistryConflict, url, info.ID)
+		}
+	}
+
+	return nil, nil
+}
+
+// syncRegistry creates the registry in the ioFog Controller, or updates it when its spec or credentials changed.
+// The credentials are hashed with key, the password of the ioFog Controller user.
+func syncRegistry(clt *iofogclient.Client, registry *appsv3.Registry, creds *registryCredentials, key []byte) error {
+	info, err := findRegistry(clt, registry, creds.url)
+	if err != nil {
+		return err
+	}
+
+	hash := creds.hash(key)
+
+	if info == nil {
+		response, err := clt.CreateRegistry(iofogclient.RegistryCreateRequest{
+			URL:      creds.url,
+			IsPublic: creds.public,
+			Username: creds.username,
+			Email:    creds.email,
+			Password: creds.password,
+		})
+		if err != nil {
+			return err
+		}
+
+		registry.Status.ID = int64(response.ID)
+	} else if !isBuiltinRegistry(info.ID) && registry.Status.CredentialsHash != hash {
+		if err := clt.UpdateRegistry(iofogclient.RegistryUpdateRequest{
+			ID:       info.ID,
+			URL:      &creds.url,
+			IsPublic: &creds.public,
+			Username: &creds.username,
+			Email:    &creds.email,
+			Password: &creds.password,
+		}); err != nil {
+			return err
+		}
+	}
+
+	registry.Status.URL = creds.url
+	registry.Status.CredentialsHash = hash
+
+	return nil
+}
+
+func deleteRegistry(clt *iofogclient.Client, registry *appsv3.Registry) error {
+	if registry.Status.ID == 0 || isBuiltinRegistry(int(registry.Status.ID)) {
+		return nil
+	}
+
+	if err := clt.DeleteRegistry(int(registry.Status.ID)); err != nil && !iofog.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
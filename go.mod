@@ -1,11 +1,12 @@
 module github.com/eclipse-iofog/iofog-operator/v3
 
-go 1.18
+go 1.20
 
 require (
 	github.com/eclipse-iofog/iofog-go-sdk/v3 v3.3.0
 	github.com/go-logr/logr v1.2.3
 	github.com/skupperproject/skupper-cli v0.0.1-beta6
+	go.uber.org/zap v1.24.0
 	k8s.io/api v0.26.0
 	k8s.io/apiextensions-apiserver v0.26.0
 	k8s.io/apimachinery v0.26.0
@@ -47,7 +48,6 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
-	go.uber.org/zap v1.24.0 // indirect
 	golang.org/x/net v0.3.1-0.20221206200815-1e63c2f08a10 // indirect
 	golang.org/x/oauth2 v0.0.0-20220223155221-ee480838109b // indirect
 	golang.org/x/sys v0.3.0 // indirect
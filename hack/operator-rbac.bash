@@ -0,0 +1,69 @@
+#!/usr/bin/env bash
+
+# Prints the RBAC granting an operator installed in OPERATOR_NAMESPACE access to the namespaces it watches:
+# the namespaces of WATCH_NAMESPACE, separated by commas, and the namespaces matching the label selector WATCH_NAMESPACE_SELECTOR.
+# config/operator/rbac.yaml only binds the operator in its own namespace, and grants it access to nodes.
+# The selector is only resolved when the operator starts: rerun after labelling new namespaces, then restart the operator.
+
+set -e
+
+OPERATOR_NAMESPACE="${OPERATOR_NAMESPACE:?OPERATOR_NAMESPACE must be set}"
+
+NAMESPACES=$(echo "$WATCH_NAMESPACE" | tr ',' '\n')
+if [ -n "$WATCH_NAMESPACE_SELECTOR" ]; then
+  NAMESPACES="$NAMESPACES
+$(kubectl get namespaces -l "$WATCH_NAMESPACE_SELECTOR" -o jsonpath='{range .items[*]}{.metadata.name}{"\n"}{end}')"
+fi
+
+for NAMESPACE in $(echo "$NAMESPACES" | tr -d ' ' | sort -u); do
+  if [ "$NAMESPACE" == "$OPERATOR_NAMESPACE" ]; then
+    continue
+  fi
+  cat <<YAML
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: iofog-operator
+  namespace: $NAMESPACE
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: iofog-operator
+subjects:
+- kind: ServiceAccount
+  name: iofog-operator
+  namespace: $OPERATOR_NAMESPACE
+YAML
+done
+
+# Namespaces matching the selector are listed when the operator starts
+if [ -n "$WATCH_NAMESPACE_SELECTOR" ]; then
+  cat <<YAML
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: iofog-operator-namespaces
+rules:
+- apiGroups:
+  - ""
+  resources:
+  - namespaces
+  verbs:
+  - list
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: iofog-operator-namespaces-$OPERATOR_NAMESPACE
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: iofog-operator-namespaces
+subjects:
+- kind: ServiceAccount
+  name: iofog-operator
+  namespace: $OPERATOR_NAMESPACE
+YAML
+fi
@@ -0,0 +1,105 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2020 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	configv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/config/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const DefaultClusterDomain = "cluster.local"
+
+var ErrControllerUnreachable = errors.New("ioFog Controller is not reachable yet")
+
+// ControllerAccess is how the operator reaches the ioFog Controllers of ControlPlanes.
+type ControllerAccess struct {
+	ClusterDomain string
+	// Mode is configv3.ControllerAccessInCluster or configv3.ControllerAccessExternal
+	Mode string
+	// Addresses of forwarded Controller API ports by namespace of their ControlPlane, which take precedence over Mode
+	Addresses map[string]string
+}
+
+// Set once on start, before the manager runs the reconcilers.
+//
+//nolint:gochecknoglobals
+var controllerAccess = ControllerAccess{
+	ClusterDomain: DefaultClusterDomain,
+	Mode:          configv3.ControllerAccessInCluster,
+}
+
+// IsInCluster reports whether the operator runs in a pod.
+func IsInCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// SetControllerAccess configures how GetControllerAddress reaches Controllers.
+func SetControllerAccess(access ControllerAccess) {
+	controllerAccess = access
+}
+
+// GetServiceHost returns the fully qualified DNS name of a Service.
+func GetServiceHost(name, namespace string) string {
+	return fmt.Sprintf("%s.%s.svc.%s", name, namespace, controllerAccess.ClusterDomain)
+}
+
+// GetControllerAddress returns the host and port the operator reaches the ioFog Controller of the ControlPlane in namespace on.
+func GetControllerAddress(ctx context.Context, c client.Client, namespace string) (string, error) {
+	port := strconv.Itoa(controllerAPIPort)
+
+	if address, found := controllerAccess.Addresses[namespace]; found {
+		return address, nil
+	}
+
+	switch controllerAccess.Mode {
+	case configv3.ControllerAccessExternal:
+		svc := &corev1.Service{}
+		if err := c.Get(ctx, types.NamespacedName{Name: controllerServiceName, Namespace: namespace}, svc); err != nil {
+			return "", err
+		}
+
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				return net.JoinHostPort(ingress.IP, port), nil
+			}
+
+			if ingress.Hostname != "" {
+				return net.JoinHostPort(ingress.Hostname, port), nil
+			}
+		}
+
+		return "", fmt.Errorf("%w: Service %s/%s has no LoadBalancer address", ErrControllerUnreachable, namespace, controllerServiceName)
+	default:
+		return net.JoinHostPort(GetServiceHost(controllerServiceName, namespace), port), nil
+	}
+}
+
+// GetControllerServerName returns the name the certificate of the ioFog Controller of the ControlPlane in namespace is verified against.
+// It is empty unless the Controller is reached on a forwarded address, as its certificate is issued for its Service instead.
+func GetControllerServerName(namespace string) string {
+	if _, found := controllerAccess.Addresses[namespace]; !found {
+		return ""
+	}
+
+	return GetServiceHost(controllerServiceName, namespace)
+}
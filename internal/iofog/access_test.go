@@ -0,0 +1,131 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iofog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	configv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/config/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func setTestControllerAccess(t *testing.T, access ControllerAccess) {
+	t.Helper()
+
+	SetControllerAccess(access)
+	t.Cleanup(func() {
+		SetControllerAccess(ControllerAccess{ClusterDomain: DefaultClusterDomain, Mode: configv3.ControllerAccessInCluster})
+	})
+}
+
+// TestGetControllerAddressConcurrently resolves the addresses of several Controllers in parallel, one of them forwarded,
+// and checks that each one is reached on its own address and verified against the name of its own Service.
+// Run with -race to also check the package level access configuration.
+func TestGetControllerAddressConcurrently(t *testing.T) {
+	forwarded := testutil.GetNamespace(0)
+
+	setTestControllerAccess(t, ControllerAccess{
+		ClusterDomain: "edge.example",
+		Mode:          configv3.ControllerAccessInCluster,
+		Addresses:     map[string]string{forwarded: "127.0.0.1:30121"},
+	})
+
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+
+	for idx := 0; idx < testutil.ControlPlanes; idx++ {
+		namespace := testutil.GetNamespace(idx)
+		serviceHost := controllerServiceName + "." + namespace + ".svc.edge.example"
+
+		wantAddress := net.JoinHostPort(serviceHost, strconv.Itoa(controllerAPIPort))
+		wantServerName := ""
+
+		if namespace == forwarded {
+			wantAddress = "127.0.0.1:30121"
+			wantServerName = serviceHost
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := checkControllerAddress(ctx, nil, namespace, wantAddress, wantServerName); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// TestGetControllerAddressExternal checks that Controllers are reached on the address of their LoadBalancer from
+// outside the cluster, and reported unreachable until it is provisioned.
+func TestGetControllerAddressExternal(t *testing.T) {
+	setTestControllerAccess(t, ControllerAccess{ClusterDomain: DefaultClusterDomain, Mode: configv3.ControllerAccessExternal})
+
+	provisioned := testutil.GetNamespace(0)
+	pending := testutil.GetNamespace(1)
+
+	c := fake.NewClientBuilder().WithScheme(testutil.NewScheme(t)).WithObjects(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: controllerServiceName, Namespace: provisioned},
+			Status: corev1.ServiceStatus{
+				LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "2001:db8::1"}}},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: controllerServiceName, Namespace: pending},
+		},
+	).Build()
+	ctx := context.Background()
+
+	if err := checkControllerAddress(ctx, c, provisioned, "[2001:db8::1]:51121", ""); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := GetControllerAddress(ctx, c, pending); err == nil || GetControlPlaneReason(err) != "ControllerUnreachable" {
+		t.Errorf("namespace %s: got error %v, want the Controller to be unreachable", pending, err)
+	}
+}
+
+func checkControllerAddress(ctx context.Context, c client.Client, namespace, wantAddress, wantServerName string) error {
+	address, err := GetControllerAddress(ctx, c, namespace)
+	if err != nil {
+		return fmt.Errorf("namespace %s: %w", namespace, err)
+	}
+
+	if address != wantAddress {
+		return fmt.Errorf("namespace %s: address %s, want %s", namespace, address, wantAddress)
+	}
+
+	if serverName := GetControllerServerName(namespace); serverName != wantServerName {
+		return fmt.Errorf("namespace %s: server name %q, want %q", namespace, serverName, wantServerName)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2020 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	iofogapps "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/apps"
+	iofogclient "github.com/eclipse-iofog/iofog-go-sdk/v3/pkg/client"
+	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	controllerServiceName           = "controller"
+	controllerAPIPort               = 51121
+	controllerCredentialsSecretName = "controller-credentials"
+	emailSecretKey                  = "email"
+	passwordSecretKey               = "password"
+)
+
+var (
+	ErrControlPlaneNotFound = errors.New("ControlPlane not found")
+	ErrControlPlaneNotReady = errors.New("ControlPlane is not ready")
+	// ErrControlPlaneNotAllowed also matches ErrControlPlaneNotFound, so that resources which lost access can still be deleted
+	ErrControlPlaneNotAllowed = errors.New("ControlPlane does not allow the namespace")
+)
+
+// GetControlPlane returns the ControlPlane referenced by ref, or the only one in namespace when ref is nil.
+// ControlPlanes of other namespaces are only returned when they allow namespace.
+func GetControlPlane(ctx context.Context, c client.Client, namespace string, ref *appsv3.ControlPlaneReference) (*cpv3.ControlPlane, error) {
+	if ref != nil {
+		cpNamespace := namespace
+		if ref.Namespace != "" {
+			cpNamespace = ref.Namespace
+		}
+
+		cp := &cpv3.ControlPlane{}
+		if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cpNamespace}, cp); err != nil {
+			if k8serrors.IsNotFound(err) {
+				return nil, fmt.Errorf("%w: %s/%s", ErrControlPlaneNotFound, cpNamespace, ref.Name)
+			}
+
+			return nil, err
+		}
+
+		if !cp.AllowsNamespace(namespace) {
+			return nil, fmt.Errorf("%w: %w: %s/%s does not list %s in spec.allowedNamespaces",
+				ErrControlPlaneNotFound, ErrControlPlaneNotAllowed, cp.Namespace, cp.Name, namespace)
+		}
+
+		return cp, nil
+	}
+
+	cps := &cpv3.ControlPlaneList{}
+	if err := c.List(ctx, cps, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	if len(cps.Items) == 0 {
+		return nil, fmt.Errorf("%w in namespace %s", ErrControlPlaneNotFound, namespace)
+	}
+
+	if len(cps.Items) > 1 {
+		return nil, fmt.Errorf("%w: found %d ControlPlanes in namespace %s, set spec.controlPlaneRef to select one", ErrControlPlaneNotFound, len(cps.Items), namespace)
+	}
+
+	return &cps.Items[0], nil
+}
+
+// GetController returns the endpoint and credentials of the ioFog Controller of a ControlPlane once it is ready.
+func GetController(ctx context.Context, c client.Client, namespace string, ref *appsv3.ControlPlaneReference) (iofogapps.IofogController, error) {
+	cp, err := GetControlPlane(ctx, c, namespace, ref)
+	if err != nil {
+		return iofogapps.IofogController{}, err
+	}
+
+	if !cp.IsReady() {
+		return iofogapps.IofogController{}, fmt.Errorf("%w: %s/%s", ErrControlPlaneNotReady, cp.Namespace, cp.Name)
+	}
+
+	// The ControlPlane keeps the credentials of the ioFog Controller user in sync with its spec
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: controllerCredentialsSecretName, Namespace: cp.Namespace}, secret); err != nil {
+		return iofogapps.IofogController{}, err
+	}
+
+	email, ok := secret.Data[emailSecretKey]
+	if !ok {
+		return iofogapps.IofogController{}, fmt.Errorf("email secret key %s not found in secret %s", emailSecretKey, controllerCredentialsSecretName)
+	}
+
+	encodedPassword, ok := secret.Data[passwordSecretKey]
+	if !ok {
+		return iofogapps.IofogController{}, fmt.Errorf("password secret key %s not found in secret %s", passwordSecretKey, controllerCredentialsSecretName)
+	}
+
+	password, err := base64.StdEncoding.DecodeString(string(encodedPassword))
+	if err != nil {
+		return iofogapps.IofogController{}, fmt.Errorf("password in secret %s is not a valid base64 string", controllerCredentialsSecretName)
+	}
+
+	endpoint, err := GetControllerAddress(ctx, c, cp.Namespace)
+	if err != nil {
+		return iofogapps.IofogController{}, err
+	}
+
+	controller := iofogapps.IofogController{
+		Email:    string(email),
+		Password: string(password),
+		Endpoint: endpoint,
+	}
+
+	if cp.Spec.Controller.IsTLSEnabled() {
+		if err := setTransport(ctx, c, cp, endpoint); err != nil {
+			return iofogapps.IofogController{}, err
+		}
+
+		controller.Endpoint = "https://" + endpoint
+	}
+
+	return controller, nil
+}
+
+// setTransport verifies the Controller of cp reached on endpoint against the CA of its TLS secret.
+func setTransport(ctx context.Context, c client.Client, cp *cpv3.ControlPlane, endpoint string) error {
+	secretName := cp.Spec.Controller.GetTLSSecretName()
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: secretName, Namespace: cp.Namespace}, secret); err != nil {
+		return err
+	}
+
+	if err := SetControllerTransport(endpoint, secret.Data[GetCAKey(secret)], GetControllerServerName(cp.Namespace)); err != nil {
+		return fmt.Errorf("trust CA of secret %s: %w", secretName, err)
+	}
+
+	return nil
+}
+
+// ReferencesControlPlane reports whether a resource in namespace referencing ref is deployed to the ControlPlane cp.
+func ReferencesControlPlane(namespace string, ref *appsv3.ControlPlaneReference, cp client.Object) bool {
+	name := ""
+
+	if ref != nil {
+		name = ref.Name
+		if ref.Namespace != "" {
+			namespace = ref.Namespace
+		}
+	}
+
+	return namespace == cp.GetNamespace() && (name == "" || name == cp.GetName())
+}
+
+// GetIofogName returns the name on the ioFog Controller of the resource name in namespace referencing ref.
+// Resources of namespaces other than the one of the ControlPlane are prefixed with their namespace, so that namespaces
+// sharing a Controller through spec.allowedNamespaces cannot overwrite or delete each other's resources.
+func GetIofogName(namespace string, ref *appsv3.ControlPlaneReference, name string) string {
+	if ref == nil || ref.Namespace == "" || ref.Namespace == namespace {
+		return name
+	}
+
+	return namespace + "-" + name
+}
+
+// GetControlPlaneReason returns the reason of a condition reporting err.
+func GetControlPlaneReason(err error) string {
+	switch {
+	case errors.Is(err, ErrControlPlaneNotAllowed):
+		return "ControlPlaneNotAllowed"
+	case errors.Is(err, ErrControlPlaneNotFound):
+		return "ControlPlaneNotFound"
+	case errors.Is(err, ErrControlPlaneNotReady):
+		return "ControlPlaneNotReady"
+	case errors.Is(err, ErrControllerUnreachable):
+		return "ControllerUnreachable"
+	default:
+		return "ControlPlaneUnavailable"
+	}
+}
+
+func NewClient(controller iofogapps.IofogController) (*iofogclient.Client, error) {
+	// Endpoint is a host and port, with IPv6 addresses in brackets, prefixed by https:// when the Controller serves TLS
+	baseURL := &url.URL{
+		Scheme: "http",
+		Host:   controller.Endpoint,
+		Path:   "/api/v3",
+	}
+
+	if scheme, host, found := strings.Cut(controller.Endpoint, "://"); found {
+		baseURL.Scheme = scheme
+		baseURL.Host = host
+	}
+
+	return iofogclient.NewAndLogin(iofogclient.Options{BaseURL: baseURL}, controller.Email, controller.Password)
+}
+
+func IsNotFound(err error) bool {
+	var notFound *iofogclient.NotFoundError
+
+	return errors.As(err, &notFound)
+}
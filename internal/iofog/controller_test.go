@@ -0,0 +1,166 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iofog
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testCallsPerCP = 4
+
+func newTestCA(t *testing.T, name string) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// newTestClient returns a fake client holding ready ControlPlanes serving TLS, each in its own namespace and with its own CA.
+func newTestClient(t *testing.T) (client.Client, map[string][]byte) {
+	t.Helper()
+
+	cas := map[string][]byte{}
+	objs := []client.Object{}
+
+	for idx := 0; idx < testutil.ControlPlanes; idx++ {
+		namespace := testutil.GetNamespace(idx)
+		cas[namespace] = newTestCA(t, namespace)
+
+		cp := &cpv3.ControlPlane{
+			ObjectMeta: metav1.ObjectMeta{Name: "iofog", Namespace: namespace},
+			Spec: cpv3.ControlPlaneSpec{
+				Controller: cpv3.Controller{
+					TLS: &cpv3.ControllerTLS{Mode: cpv3.ControllerTLSModeSecret, SecretName: "controller-tls"},
+				},
+			},
+		}
+		cp.SetConditionReady(nil)
+
+		objs = append(objs,
+			cp,
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: controllerCredentialsSecretName, Namespace: namespace},
+				Data: map[string][]byte{
+					emailSecretKey:    []byte("user@" + namespace),
+					passwordSecretKey: []byte(base64.StdEncoding.EncodeToString([]byte(namespace))),
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "controller-tls", Namespace: namespace},
+				Data:       map[string][]byte{CACertSecretKey: cas[namespace]},
+			},
+		)
+	}
+
+	return fake.NewClientBuilder().WithScheme(testutil.NewScheme(t)).WithObjects(objs...).Build(), cas
+}
+
+// TestGetControllerConcurrently resolves the Controllers of several ControlPlanes serving TLS in parallel, as the
+// Application, Agent and other reconcilers do, and checks that none of their transports trusts the CA of another one.
+func TestGetControllerConcurrently(t *testing.T) {
+	c, cas := newTestClient(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+
+	for idx := 0; idx < testutil.ControlPlanes; idx++ {
+		namespace := testutil.GetNamespace(idx)
+
+		wantRoots := x509.NewCertPool()
+		wantRoots.AppendCertsFromPEM(cas[namespace])
+
+		for call := 0; call < testCallsPerCP; call++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if err := checkControllerTransport(ctx, c, namespace, wantRoots); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+	}
+
+	wg.Wait()
+}
+
+func checkControllerTransport(ctx context.Context, c client.Client, namespace string, wantRoots *x509.CertPool) error {
+	controller, err := GetController(ctx, c, namespace, nil)
+	if err != nil {
+		return fmt.Errorf("namespace %s: %w", namespace, err)
+	}
+
+	if controller.Email != "user@"+namespace || controller.Password != namespace {
+		return fmt.Errorf("namespace %s: credentials of user %s", namespace, controller.Email)
+	}
+
+	endpoint, found := strings.CutPrefix(controller.Endpoint, "https://")
+	if !found {
+		return fmt.Errorf("namespace %s: endpoint %s is not served over TLS", namespace, controller.Endpoint)
+	}
+
+	transport := GetControllerTransport(endpoint)
+	if transport == nil {
+		return fmt.Errorf("namespace %s: no transport", namespace)
+	}
+
+	if !transport.TLSClientConfig.RootCAs.Equal(wantRoots) {
+		return fmt.Errorf("namespace %s: transport trusts the CA of another ControlPlane", namespace)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2020 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Keys of the secrets holding the certificate of an ioFog Controller, as written by cert-manager.
+const (
+	TLSCertSecretKey = corev1.TLSCertKey
+	TLSKeySecretKey  = corev1.TLSPrivateKeyKey
+	CACertSecretKey  = "ca.crt"
+)
+
+var errNoCACertificate = errors.New("no PEM encoded certificate found")
+
+// GetCAKey returns the key of a TLS secret holding the CA of its certificate.
+// Secrets of certificates issued by public CAs may not hold one, their certificate is trusted as is.
+func GetCAKey(secret *corev1.Secret) string {
+	if len(secret.Data[CACertSecretKey]) > 0 {
+		return CACertSecretKey
+	}
+
+	return TLSCertSecretKey
+}
+
+// controllerTransports holds the transport of each Controller serving TLS, by the host and port it is reached on.
+var controllerTransports sync.Map
+
+type controllerTransport struct {
+	caPEM      []byte
+	serverName string
+	transport  *http.Transport
+}
+
+// controllerRoundTripper sends the requests to the Controllers serving TLS through their own transport.
+type controllerRoundTripper struct {
+	fallback http.RoundTripper
+}
+
+func (rt *controllerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		if transport := GetControllerTransport(req.URL.Host); transport != nil {
+			return transport.RoundTrip(req)
+		}
+	}
+
+	return rt.fallback.RoundTrip(req)
+}
+
+// InstallControllerTransport routes the requests of the ioFog clients to the transports set by SetControllerTransport.
+// The clients of the SDK send their requests through http.DefaultTransport, so it must be called once before they are
+// used. Requests to a Controller without a transport are verified against the system roots, and fail for private CAs.
+func InstallControllerTransport() {
+	http.DefaultTransport = &controllerRoundTripper{fallback: http.DefaultTransport}
+}
+
+// SetControllerTransport makes the ioFog clients only trust caPEM for the Controller reached on endpoint, a host and port.
+// serverName is the name the certificate is verified against, or empty for the host of endpoint.
+func SetControllerTransport(endpoint string, caPEM []byte, serverName string) error {
+	if found, ok := controllerTransports.Load(endpoint); ok {
+		current, _ := found.(*controllerTransport)
+		if bytes.Equal(current.caPEM, caPEM) && current.serverName == serverName {
+			return nil
+		}
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return errNoCACertificate
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSHandshakeTimeout: 10 * time.Second, //nolint:gomnd
+		TLSClientConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			RootCAs:    roots,
+			ServerName: serverName,
+		},
+	}
+
+	// Connections of a rotated CA are closed, they were verified against the previous one
+	if previous, loaded := controllerTransports.Swap(endpoint, &controllerTransport{caPEM: caPEM, serverName: serverName, transport: transport}); loaded {
+		if previous, ok := previous.(*controllerTransport); ok {
+			previous.transport.CloseIdleConnections()
+		}
+	}
+
+	return nil
+}
+
+// GetControllerTransport returns the transport of the Controller reached on endpoint, or nil when it has none.
+func GetControllerTransport(endpoint string) *http.Transport {
+	found, ok := controllerTransports.Load(endpoint)
+	if !ok {
+		return nil
+	}
+
+	current, _ := found.(*controllerTransport)
+
+	return current.transport
+}
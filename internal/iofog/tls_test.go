@@ -0,0 +1,55 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iofog
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestControllerRoundTripper checks that requests to a Controller serving TLS go through the transport trusting its CA,
+// and that other requests keep the fallback transport, which does not trust it.
+func TestControllerRoundTripper(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	httpClient := &http.Client{Transport: &controllerRoundTripper{fallback: &http.Transport{}}}
+
+	if _, err := httpClient.Get(server.URL); err == nil {
+		t.Fatal("request without a Controller transport trusted the CA of the server")
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := SetControllerTransport(server.Listener.Addr().String(), caPEM, ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { controllerTransports.Delete(server.Listener.Addr().String()) })
+
+	response, err := httpClient.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("status %d, want %d", response.StatusCode, http.StatusOK)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2020 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+package manager
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	configv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/config/v3"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+)
+
+const resolvConfPath = "/etc/resolv.conf"
+
+var errInvalidControllerAccess = errors.New("invalid controller access configuration")
+
+// DetectClusterDomain returns the cluster domain out of the search domains of a pod, e.g. svc.cluster.local,
+// or an empty string when none is found.
+func DetectClusterDomain(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "search" {
+			continue
+		}
+
+		for _, domain := range fields[1:] {
+			if suffix, found := strings.CutPrefix(strings.TrimSuffix(domain, "."), "svc."); found && suffix != "" {
+				return suffix
+			}
+		}
+	}
+
+	return ""
+}
+
+// ParseControllerAddresses parses comma separated namespace=host:port pairs of forwarded Controller API ports.
+func ParseControllerAddresses(value string) (map[string]string, error) {
+	addresses := map[string]string{}
+
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		namespace, address, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("%w: %s is not a namespace=host:port pair", errInvalidControllerAccess, pair)
+		}
+
+		addresses[namespace] = address
+	}
+
+	return addresses, nil
+}
+
+// SetControllerAccess configures how the reconcilers reach the ioFog Controllers of ControlPlanes.
+// The cluster domain is detected when running in a pod, and Controllers are reached through their LoadBalancers otherwise.
+func SetControllerAccess(clusterDomain string, access *configv3.ControllerAccessConfig) error {
+	if clusterDomain == "" && iofog.IsInCluster() {
+		clusterDomain = DetectClusterDomain(resolvConfPath)
+	}
+
+	if clusterDomain == "" {
+		clusterDomain = iofog.DefaultClusterDomain
+	}
+
+	mode := access.Mode
+
+	switch mode {
+	case "":
+		mode = configv3.ControllerAccessExternal
+		if iofog.IsInCluster() {
+			mode = configv3.ControllerAccessInCluster
+		}
+	case configv3.ControllerAccessInCluster, configv3.ControllerAccessExternal:
+	default:
+		return fmt.Errorf("%w: mode must be %s or %s", errInvalidControllerAccess, configv3.ControllerAccessInCluster, configv3.ControllerAccessExternal)
+	}
+
+	for namespace, address := range access.Addresses {
+		if namespace == "" {
+			return fmt.Errorf("%w: address %s has no namespace", errInvalidControllerAccess, address)
+		}
+
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("%w: address of namespace %s: %s", errInvalidControllerAccess, namespace, err.Error())
+		}
+	}
+
+	iofog.SetControllerAccess(iofog.ControllerAccess{
+		ClusterDomain: strings.TrimSuffix(clusterDomain, "."),
+		Mode:          mode,
+		Addresses:     access.Addresses,
+	})
+
+	return nil
+}
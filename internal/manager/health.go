@@ -0,0 +1,91 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2020 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+package manager
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+const (
+	cacheSyncTimeout = time.Second
+	// Names of the certificate files of the webhook server of controller-runtime
+	webhookCertName = "tls.crt"
+	webhookKeyName  = "tls.key"
+)
+
+var (
+	errCacheNotSynced      = errors.New("informer caches are not synced")
+	errInvalidWebhookCerts = errors.New("invalid webhook certificates")
+)
+
+// AddHealthChecks registers the liveness and readiness checks of the operator.
+// The webhook certificates are only checked when certDir is set.
+func AddHealthChecks(mgr ctrl.Manager, certDir string) error {
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		return err
+	}
+
+	if err := mgr.AddReadyzCheck("cache-sync", cacheSyncCheck(mgr)); err != nil {
+		return err
+	}
+
+	if certDir == "" {
+		return nil
+	}
+
+	return mgr.AddReadyzCheck("webhook-certs", webhookCertsCheck(certDir))
+}
+
+func cacheSyncCheck(mgr ctrl.Manager) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), cacheSyncTimeout)
+		defer cancel()
+
+		if !mgr.GetCache().WaitForCacheSync(ctx) {
+			return errCacheNotSynced
+		}
+
+		return nil
+	}
+}
+
+// webhookCertsCheck fails while the certificates are missing, e.g. not yet issued by cert-manager, or expired.
+func webhookCertsCheck(certDir string) healthz.Checker {
+	return func(_ *http.Request) error {
+		pair, err := tls.LoadX509KeyPair(filepath.Join(certDir, webhookCertName), filepath.Join(certDir, webhookKeyName))
+		if err != nil {
+			return fmt.Errorf("%w: %s", errInvalidWebhookCerts, err.Error())
+		}
+
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("%w: %s", errInvalidWebhookCerts, err.Error())
+		}
+
+		if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return fmt.Errorf("%w: certificate is only valid from %s to %s", errInvalidWebhookCerts, cert.NotBefore, cert.NotAfter)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2020 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	configv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/config/v3"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var errInvalidLogging = errors.New("invalid logging configuration")
+
+// parseLevel accepts the levels of the --zap-log-level flag: debug, info, error, or an integer above zero.
+func parseLevel(level string) (zapcore.Level, error) {
+	if verbosity, err := strconv.Atoi(level); err == nil {
+		if verbosity <= 0 {
+			return 0, fmt.Errorf("%w: level %d must be above zero", errInvalidLogging, verbosity)
+		}
+
+		return zapcore.Level(-verbosity), nil
+	}
+
+	var parsed zapcore.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("%w: %s", errInvalidLogging, err.Error())
+	}
+
+	return parsed, nil
+}
+
+// ApplyLoggingConfig sets the options of the logger from the configuration file.
+// Options set through the --zap-* flags, named in setFlags, take precedence.
+func ApplyLoggingConfig(opts *zap.Options, logging *configv3.LoggingConfig, setFlags map[string]bool) error {
+	if !setFlags["zap-devel"] {
+		opts.Development = logging.Development
+	}
+
+	if !setFlags["zap-encoder"] {
+		switch logging.Encoder {
+		case "":
+		case configv3.LogEncoderJSON:
+			zap.JSONEncoder()(opts)
+		case configv3.LogEncoderConsole:
+			zap.ConsoleEncoder()(opts)
+		default:
+			return fmt.Errorf("%w: encoder must be %s or %s", errInvalidLogging, configv3.LogEncoderJSON, configv3.LogEncoderConsole)
+		}
+	}
+
+	if !setFlags["zap-log-level"] && logging.Level != "" {
+		level, err := parseLevel(logging.Level)
+		if err != nil {
+			return err
+		}
+
+		opts.Level = level
+	}
+
+	if !setFlags["zap-stacktrace-level"] && logging.StacktraceLevel != "" {
+		level, err := parseLevel(logging.StacktraceLevel)
+		if err != nil {
+			return err
+		}
+
+		opts.StacktraceLevel = level
+	}
+
+	return nil
+}
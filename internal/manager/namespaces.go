@@ -0,0 +1,83 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2020 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+package manager
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=list
+
+// GetWatchNamespaces returns the namespaces listed in namespaces, separated by commas, and the namespaces matching selector.
+// Namespaces matching selector are only listed once, namespaces created later are not watched until the operator restarts.
+func GetWatchNamespaces(ctx context.Context, cfg *rest.Config, namespaces, selector string) ([]string, error) {
+	found := map[string]bool{}
+
+	for _, namespace := range strings.Split(namespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			found[namespace] = true
+		}
+	}
+
+	if selector != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return nil, err
+		}
+
+		// The cache of the manager is not started yet
+		clt, err := client.New(cfg, client.Options{})
+		if err != nil {
+			return nil, err
+		}
+
+		list := &corev1.NamespaceList{}
+		if err := clt.List(ctx, list, client.MatchingLabelsSelector{Selector: parsed}); err != nil {
+			return nil, err
+		}
+
+		for idx := range list.Items {
+			found[list.Items[idx].Name] = true
+		}
+	}
+
+	result := make([]string, 0, len(found))
+	for namespace := range found {
+		result = append(result, namespace)
+	}
+
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// SetWatchNamespaces restricts the cache of the manager to namespaces. Options are left unchanged without namespaces.
+func SetWatchNamespaces(options *ctrl.Options, namespaces []string) {
+	switch len(namespaces) {
+	case 0:
+	case 1:
+		options.Namespace = namespaces[0]
+	default:
+		options.Namespace = ""
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+}
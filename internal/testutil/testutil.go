@@ -0,0 +1,48 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2020 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+// Package testutil holds the fixtures shared by the unit tests of the operator.
+package testutil
+
+import (
+	"strconv"
+	"testing"
+
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// ControlPlanes is the number of ControlPlanes the tests handle in parallel, each in its own namespace.
+const ControlPlanes = 6
+
+// GetNamespace returns the namespace of the ControlPlane idx.
+func GetNamespace(idx int) string {
+	return "iofog-" + strconv.Itoa(idx)
+}
+
+// NewScheme returns a scheme of the Kubernetes and ControlPlane types.
+func NewScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cpv3.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	return scheme
+}
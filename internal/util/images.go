@@ -13,7 +13,12 @@
 
 package util
 
-import "fmt"
+import (
+	"fmt"
+
+	configv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/config/v3"
+	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+)
 
 // These values are set by the linker, e.g. "LDFLAGS += -X $(PREFIX).controllerTag=v3.0.0-beta1".
 var (
@@ -42,3 +47,65 @@ func GetPortManagerImage() string {
 	return fmt.Sprintf("%s/%s:%s", repo, portManagerImage, portManagerTag)
 }
 func GetProxyImage() string { return fmt.Sprintf("%s/%s:%s", repo, proxyImage, proxyTag) }
+
+// Third party images used by ControlPlane backup, restore and migration Jobs, overridden by the images of the OperatorConfig.
+var (
+	sqliteImage        = "keinos/sqlite3:3.46.1"                 //nolint:gochecknoglobals
+	postgresRepository = "postgres"                              //nolint:gochecknoglobals
+	mysqlImage         = "mysql:8.0"                             //nolint:gochecknoglobals
+	s3TransferImage    = "minio/mc:RELEASE.2024-11-21T17-21-54Z" //nolint:gochecknoglobals
+	pvcTransferImage   = "busybox:1.36"                          //nolint:gochecknoglobals
+	migrationImage     = "ghcr.io/dimitri/pgloader:v3.6.9"       //nolint:gochecknoglobals
+)
+
+// DefaultPostgresVersion is the major version of the postgres clients when spec.database.version is empty.
+const DefaultPostgresVersion = "15"
+
+// SetThirdPartyImages overrides the third party images with the ones set in images. It must be called before the
+// reconcilers start.
+func SetThirdPartyImages(images *configv3.ImagesConfig) {
+	setImage(&sqliteImage, images.Sqlite)
+	setImage(&postgresRepository, images.Postgres)
+	setImage(&mysqlImage, images.MySQL)
+	setImage(&s3TransferImage, images.S3Transfer)
+	setImage(&pvcTransferImage, images.PVCTransfer)
+	setImage(&migrationImage, images.Migration)
+}
+
+func setImage(image *string, override string) {
+	if override != "" {
+		*image = override
+	}
+}
+
+// GetPostgresImage returns the image of the postgres clients matching the major version of the server, so that
+// pg_dump can read it.
+func GetPostgresImage(version string) string {
+	if version == "" {
+		version = DefaultPostgresVersion
+	}
+
+	return fmt.Sprintf("%s:%s-alpine", postgresRepository, version)
+}
+
+func GetBackupDumpImage(db *cpv3.Database) string {
+	switch db.Provider {
+	case "postgres":
+		return GetPostgresImage(db.Version)
+	case "mysql":
+		return mysqlImage
+	default:
+		return sqliteImage
+	}
+}
+
+func GetBackupTransferImage(s3 bool) string {
+	if s3 {
+		return s3TransferImage
+	}
+
+	return pvcTransferImage
+}
+
+func GetMigrationImage() string { return migrationImage }
+func GetSqliteImage() string    { return sqliteImage }
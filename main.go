@@ -17,17 +17,28 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"time"
 
 	appsv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/apps/v3"
+	configv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/config/v3"
 	cpv3 "github.com/eclipse-iofog/iofog-operator/v3/apis/controlplanes/v3"
+	agentscontroller "github.com/eclipse-iofog/iofog-operator/v3/controllers/agents"
 	appscontroller "github.com/eclipse-iofog/iofog-operator/v3/controllers/apps"
+	catalogitemscontroller "github.com/eclipse-iofog/iofog-operator/v3/controllers/catalogitems"
 	controlplanescontroller "github.com/eclipse-iofog/iofog-operator/v3/controllers/controlplanes"
+	edgeresourcescontroller "github.com/eclipse-iofog/iofog-operator/v3/controllers/edgeresources"
+	registriescontroller "github.com/eclipse-iofog/iofog-operator/v3/controllers/registries"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/iofog"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/manager"
+	"github.com/eclipse-iofog/iofog-operator/v3/internal/util"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	// +kubebuilder:scaffold:imports
@@ -40,47 +51,181 @@ func init() { //nolint:gochecknoinits
 
 	utilruntime.Must(appsv3.AddToScheme(scheme))
 	utilruntime.Must(cpv3.AddToScheme(scheme))
+	utilruntime.Must(configv3.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 } //nolint:wsl
 
-// getWatchNamespace returns the Namespace the operator should be watching for changes.
-func getWatchNamespace() string {
-	// WatchNamespaceEnvVar is the constant for env variable WATCH_NAMESPACE
-	// which specifies the Namespace to watch.
-	// An empty value means the operator is running with cluster scope.
-	ns, _ := os.LookupEnv("WATCH_NAMESPACE")
+// getWatchNamespaces returns the Namespaces the operator should be watching for changes.
+// WATCH_NAMESPACE lists Namespaces separated by commas, and WATCH_NAMESPACE_SELECTOR adds the Namespaces matching a label selector.
+// The selector is resolved once, Namespaces labelled afterwards are only watched once the operator restarts.
+// Empty values mean the operator is running with cluster scope.
+func getWatchNamespaces(cfg *rest.Config) ([]string, error) {
+	namespaces, _ := os.LookupEnv("WATCH_NAMESPACE")
+	selector, _ := os.LookupEnv("WATCH_NAMESPACE_SELECTOR")
 
-	return ns
+	return manager.GetWatchNamespaces(context.Background(), cfg, namespaces, selector)
+}
+
+// setDefaultOptions sets the options left unset by both the flags and the configuration file.
+func setDefaultOptions(options *ctrl.Options) {
+	if options.MetricsBindAddress == "" {
+		options.MetricsBindAddress = ":8080"
+	}
+
+	if options.HealthProbeBindAddress == "" {
+		options.HealthProbeBindAddress = ":8081"
+	}
+
+	if options.Port == 0 {
+		options.Port = 9443
+	}
+
+	if options.LeaderElectionID == "" {
+		options.LeaderElectionID = "44586fd0.iofog.org"
+	}
 }
 
 func main() {
 	setupLog := ctrl.Log.WithName("setup")
 
-	var metricsAddr string
+	var configFile, metricsAddr, probeAddr, leaderElectionNamespace, webhookCertDir string
+
+	var clusterDomain, controllerAccessMode, controllerAddresses string
 
 	var enableLeaderElection bool
 
-	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	var leaseDuration, renewDeadline, retryPeriod time.Duration
+
+	var webhookPort int
+
+	flag.StringVar(&configFile, "config", "",
+		"The OperatorConfig file the operator loads its configuration from. "+
+			"Flags take precedence over the values of the file.")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "The address the metric endpoint binds to. Defaults to :8080.")
+	flag.StringVar(&probeAddr, "health-probe-addr", "", "The address the /healthz and /readyz endpoints bind to. Defaults to :8081.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "",
+		"The namespace of the leader election lease. Defaults to the namespace of the operator.")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", 0,
+		"How long non-leaders wait before acquiring a lease which was not renewed. Defaults to 15s.")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 0,
+		"How long the leader retries renewing its lease before giving it up. Defaults to 10s.")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", 0,
+		"How long leader election clients wait between attempts. Defaults to 2s.")
+	flag.IntVar(&webhookPort, "webhook-port", 0, "The port the webhook server binds to. Defaults to 9443.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "",
+		"The directory of the tls.crt and tls.key files of the webhook server. "+
+			"When set, the readiness probe fails while the certificates are missing or expired.")
+
+	flag.StringVar(&clusterDomain, "cluster-domain", "",
+		"The DNS domain of the cluster. Defaults to the one found in /etc/resolv.conf, or cluster.local.")
+	flag.StringVar(&controllerAccessMode, "controller-access", "",
+		"How the operator reaches ioFog Controllers: InCluster through the DNS names of their Services, "+
+			"or External through the addresses of their LoadBalancers. Defaults to InCluster when running in a pod, External otherwise.")
+	flag.StringVar(&controllerAddresses, "controller-addresses", "",
+		"Comma separated addresses of forwarded ioFog Controller API ports by namespace, e.g. iofog=localhost:51121 while "+
+			"kubectl port-forward -n iofog svc/controller 51121 runs. Take precedence over --controller-access.")
+
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	setFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	options := ctrl.Options{
+		Scheme:                  scheme,
+		MetricsBindAddress:      metricsAddr,
+		HealthProbeBindAddress:  probeAddr,
+		Port:                    webhookPort,
+		CertDir:                 webhookCertDir,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionNamespace: leaderElectionNamespace,
+	}
+
+	if leaseDuration > 0 {
+		options.LeaseDuration = &leaseDuration
+	}
+
+	if renewDeadline > 0 {
+		options.RenewDeadline = &renewDeadline
+	}
+
+	if retryPeriod > 0 {
+		options.RetryPeriod = &retryPeriod
+	}
+
+	// Concurrency of each controller is configured in the file, e.g. controller.groupKindConcurrency
+	var err error
+
+	operatorConfig := configv3.OperatorConfig{}
+
+	if configFile != "" {
+		options, err = options.AndFrom(ctrl.ConfigFile().AtPath(configFile).OfKind(&operatorConfig))
+		if err == nil {
+			err = manager.ApplyLoggingConfig(&opts, &operatorConfig.Logging, setFlags)
+		}
+	}
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		Port:               9443,
-		LeaderElection:     enableLeaderElection,
-		LeaderElectionID:   "44586fd0.iofog.org",
-		Namespace:          getWatchNamespace(),
-	})
+	if err != nil {
+		setupLog.Error(err, "unable to load configuration file", "file", configFile)
+		os.Exit(1)
+	}
+
+	setDefaultOptions(&options)
+
+	if setFlags["cluster-domain"] {
+		operatorConfig.ClusterDomain = clusterDomain
+	}
+
+	if setFlags["controller-access"] {
+		operatorConfig.ControllerAccess.Mode = controllerAccessMode
+	}
+
+	if setFlags["controller-addresses"] {
+		operatorConfig.ControllerAccess.Addresses, err = manager.ParseControllerAddresses(controllerAddresses)
+	}
+
+	if err == nil {
+		err = manager.SetControllerAccess(operatorConfig.ClusterDomain, &operatorConfig.ControllerAccess)
+	}
+
+	if err != nil {
+		setupLog.Error(err, "unable to configure access to ioFog Controllers")
+		os.Exit(1)
+	}
+
+	util.SetThirdPartyImages(&operatorConfig.Images)
+
+	// The ioFog clients verify each Controller serving TLS against its own CA
+	iofog.InstallControllerTransport()
+
+	cfg := ctrl.GetConfigOrDie()
+
+	namespaces, err := getWatchNamespaces(cfg)
+	if err != nil {
+		setupLog.Error(err, "unable to get watched namespaces")
+		os.Exit(1)
+	}
+
+	setupLog.Info("watching namespaces", "namespaces", namespaces)
+	manager.SetWatchNamespaces(&options, namespaces)
+
+	mgr, err := ctrl.NewManager(cfg, options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	if err := manager.AddHealthChecks(mgr, options.CertDir); err != nil {
+		setupLog.Error(err, "unable to set up health checks")
+		os.Exit(1)
+	}
+
 	if err = (&appscontroller.ApplicationReconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("Application"),
@@ -98,6 +243,51 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "ControlPlane")
 		os.Exit(1)
 	}
+
+	if err = (&controlplanescontroller.ControlPlaneRestoreReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("ControlPlaneRestore"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ControlPlaneRestore")
+		os.Exit(1)
+	}
+
+	if err = (&agentscontroller.AgentReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("Agent"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Agent")
+		os.Exit(1)
+	}
+
+	if err = (&registriescontroller.RegistryReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("Registry"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Registry")
+		os.Exit(1)
+	}
+
+	if err = (&catalogitemscontroller.CatalogItemReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("CatalogItem"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CatalogItem")
+		os.Exit(1)
+	}
+
+	if err = (&edgeresourcescontroller.EdgeResourceReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("EdgeResource"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EdgeResource")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
@@ -19,8 +19,7 @@ function testDeleteNamespace() {
 
 function testCreateCRD() {
   startTest
-  kctl apply -f config/crd/bases/iofog.org_applications.yaml
-  kctl apply -f config/crd/bases/iofog.org_controlplanes.yaml
+  kctl apply -k config/crd
   kctl get crds | grep "controlplanes\.iofog\.org"
   kctl get crds | grep "apps\.iofog\.org"
   stopTest
@@ -28,16 +27,17 @@ function testCreateCRD() {
 
 function testDeployOperator() {
   startTest
-  kctl apply -f config/operator/rbac.yaml
+  sed "s/namespace: iofog$/namespace: $NAMESPACE/" config/operator/rbac.yaml | kctl apply -f -
+  kctl apply -f config/operator/config.yaml
   kctl apply -f config/operator/deployment.yaml
   kctl wait --for=condition=Ready pods -l name=iofog-operator --timeout 1m
   kctl describe pods -l name=iofog-operator | grep "$OP_VERSION"
   local TXTS=(
     "successfully acquired lease"
-    'Starting Controller	{"controller": "application", "controllerGroup": "iofog.org", "controllerKind": "Application"}'
-    'Starting Controller	{"controller": "controlplane", "controllerGroup": "iofog.org", "controllerKind": "ControlPlane"}'
-    'Starting workers	{"controller": "application", "controllerGroup": "iofog.org", "controllerKind": "Application", "worker count": 1}'
-    'Starting workers	{"controller": "controlplane", "controllerGroup": "iofog.org", "controllerKind": "ControlPlane", "worker count": 1}'
+    '"msg":"Starting Controller","controller":"application","controllerGroup":"iofog.org","controllerKind":"Application"'
+    '"msg":"Starting Controller","controller":"controlplane","controllerGroup":"iofog.org","controllerKind":"ControlPlane"'
+    '"msg":"Starting workers","controller":"application","controllerGroup":"iofog.org","controllerKind":"Application","worker count":1'
+    '"msg":"Starting workers","controller":"controlplane","controllerGroup":"iofog.org","controllerKind":"ControlPlane","worker count":1'
   )
   for TXT in "${TXTS[@]}"; do
     waitCmdGrep 30 "kctl logs -l name=iofog-operator" "$TXT"
@@ -53,6 +53,40 @@ function testCreateControlplane() {
   kctl wait --for=condition=Ready pods -l name=controller --timeout 1m || kctl wait --for=condition=Ready pods -l name=controller --timeout 1m
   kctl wait --for=condition=Ready pods -l name=port-manager --timeout 1m
   kctl wait --for=condition=Ready pods -l name=router --timeout 1m
-  [ -z "$(kctl logs -l name=iofog-operator | grep "ERROR")" ]
+  [ -z "$(kctl logs -l name=iofog-operator | grep '"level":"error"')" ]
+  stopTest
+}
+
+function testDeployMinio() {
+  startTest
+  kctl apply -f test/manifests/minio.yaml
+  kctl wait --for=condition=Ready pods -l name=minio --timeout 2m
+  kctl wait --for=condition=complete job/minio-bucket --timeout 2m
+  stopTest
+}
+
+function testBackupToMinio() {
+  startTest
+  local TARGET='{"s3":{"endpoint":"http://minio:9000","bucket":"iofog-backups","credentialsSecret":"minio-credentials"}}'
+  kctl patch controlplane iofog --type merge -p "{\"spec\":{\"backup\":{\"schedule\":\"0 0 1 1 *\",\"target\":$TARGET}}}"
+  waitCmdGrep 60 "kctl get cronjobs" "controller-backup"
+  kctl create job controller-backup-test --from=cronjob/controller-backup
+  kctl wait --for=condition=complete job/controller-backup-test --timeout 3m
+  # Objects of a single drive MinIO are directories named after their key
+  local BACKUP=$(kctl exec deploy/minio -- ls /data/iofog-backups | grep '^controller-.*\.sqlite$' | tail -1)
+  [ -n "$BACKUP" ]
+  echo "$BACKUP" > /tmp/bats.backup
+  stopTest
+}
+
+function testRestoreFromMinio() {
+  startTest
+  local BACKUP=$(cat /tmp/bats.backup)
+  kctl annotate controlplane iofog "iofog.org/restore-from=$BACKUP"
+  waitCmdGrep 300 "kctl get controlplanerestores -oyaml" "phase: completed"
+  waitCmdGrep 60 "kctl get controlplane iofog -oyaml" "type: ready"
+  [ -z "$(kctl get controlplane iofog -o jsonpath='{.metadata.annotations}' | grep 'iofog.org/restore')" ]
+  kctl wait --for=condition=Ready pods -l name=controller --timeout 2m
+  rm /tmp/bats.backup
   stopTest
 }
@@ -0,0 +1,43 @@
+#!/usr/bin/env bash
+
+. test/bash/include.bash
+
+@test "Initialize tests" {
+    stopTest
+}
+
+@test "Verify kubectl works" {
+    testKubectl
+}
+
+@test "Create k8s namespace" {
+    testCreateNamespace
+}
+
+@test "Create crds" {
+    testCreateCRD
+}
+
+@test "Deploy operator" {
+    testDeployOperator
+}
+
+@test "Create controlplane" {
+    testCreateControlplane
+}
+
+@test "Deploy MinIO backup target" {
+    testDeployMinio
+}
+
+@test "Back up controlplane to MinIO" {
+    testBackupToMinio
+}
+
+@test "Restore controlplane from MinIO" {
+    testRestoreFromMinio
+}
+
+@test "Delete k8s namespace" {
+    testDeleteNamespace
+}
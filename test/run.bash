@@ -16,7 +16,7 @@ fi
 # Get test names from args, run all if empty
 TESTS="$1"
 if [ -z "$TESTS" ]; then
-    TESTS=("controlplane")
+    TESTS=("controlplane" "backup")
 fi
 
 # Run tests